@@ -25,12 +25,17 @@ THE SOFTWARE.
 package validator
 
 import (
+	"cmp"
+	"encoding"
 	"fmt"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 type FuncTypeError struct {
@@ -56,13 +61,46 @@ func (e *FuncError) Error() string {
 }
 
 type ValidationError struct {
-	Value string // the value being validated
-	Param string // the parameter name from the supplied map/form data
+	Value   string   // the value being validated
+	Param   string   // the parameter name from the supplied map/form data
+	Rule    string   // the directive which failed, for example range(1:10)
+	Err     error    // the error returned by a user supplied function, if any
+	Allowed []string // the allowed values when a oneof directive failed
 }
 
 // Returned when the input fails validation for the Validater.
 func (e *ValidationError) Error() string {
-	return "validate: error param " + e.Param + " failed validation with value " + e.Value
+	msg := "validate: error param " + e.Param + " failed validation with value " + e.Value
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the error returned by a user supplied function.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+type UnknownDirectiveError struct {
+	Field     string // the Field name with the directive
+	Directive string // the directive which is not built in or registered
+}
+
+// Returned when a validate tag uses a directive which is neither built in nor added as a custom function.
+func (e *UnknownDirectiveError) Error() string {
+	return "validate: error unknown directive " + e.Directive + " for " + e.Field
+}
+
+type GroupError struct {
+	Members []string // the parameters of the group's members
+	Rule    string   // the rule that failed, exactlyone(email|phone)
+	Count   int      // how many of the members had a value
+}
+
+// Returned when the number of members of a group with a value breaks the group's rule.
+func (e *GroupError) Error() string {
+	return "validate: error " + strconv.Itoa(e.Count) + " of " + strings.Join(e.Members, ", ") + " were set which fails " + e.Rule
 }
 
 type TagError struct {
@@ -80,51 +118,356 @@ type Validater interface {
 	Validate(string, interface{}) error // Returns error if validation fails.
 }
 
+// A TypedValidater is a Validater which only accepts values of a single type. When
+// registered with AddValidater, fields which can't produce a value of ValueType fail
+// to compile with a FuncTypeError. Values of the same kind are converted, so a
+// TypedValidater for int may be used on int8 through int64 fields.
+type TypedValidater interface {
+	Validater
+	ValueType() reflect.Type // the type of value passed to Validate.
+}
+
 // contains our function -> Validater mappings.
 type validatorFunctions struct {
 	sync.RWMutex
-	Funcs map[string]func(string) error
+	Funcs      map[string]func(string) error
+	ArgFuncs   map[string]func([]string) (Validater, error) // functions added with AddWithArgs.
+	Validaters map[string]Validater                         // Validaters added with AddValidater.
+	Transforms map[string]func(string) string               // transforms added with RegisterTransform.
 }
 
-var userFns *validatorFunctions
+// names which are handled by parseValidate and can't be used for custom functions.
+var builtinDirectives = map[string]bool{
+	"optional":    true,
+	"range":       true,
+	"len":         true,
+	"bytelen":     true,
+	"runelen":     true,
+	"graphemelen": true,
+	"layout":      true,
+	"after":       true,
+	"before":      true,
+	"within":      true,
+	"oneof":       true,
+	"oneofci":     true,
+	"count":       true,
+	"minitems":    true,
+	"maxitems":    true,
+	"unique":      true,
+	"partial":     true,
+	"split":       true,
+	"trim":        true,
+	"lower":       true,
+	"upper":       true,
+	"collapse":    true,
+	"default":     true,
+	"eqfield":     true,
+	"nefield":     true,
+	"gtfield":     true,
+	"gtefield":    true,
+	"ltfield":     true,
+	"ltefield":    true,
+
+	"required_if":      true,
+	"required_with":    true,
+	"required_without": true,
+	"excluded_if":      true,
+	"gt":               true,
+	"gte":              true,
+	"lt":               true,
+	"lte":              true,
+}
 
-// Adds a new validater function type to allow custom validators to be used.
-// Simply pass in the function name as a key to use in the struct tag which
-// will be used to look up and execute the function when validation is set
-// to occur. Note you must call this prior to running validation on a struct
-// which uses the function.
+// Adds a new validater function type to the default Validator to allow custom
+// validators to be used. Simply pass in the function name as a key to use in the
+// struct tag which will be used to look up and execute the function when validation
+// is set to occur. Adding a function with an existing name replaces it.
 func Add(fn string, validateFn func(string) error) error {
-	if fn == "optional" || fn == "range" || fn == "len" {
+	return std.Add(fn, validateFn)
+}
+
+// Add registers a custom validater function with this Validator only. See the package level Add.
+// Adding a function clears the field cache so structures already assigned pick it up.
+func (vd *Validator) Add(fn string, validateFn func(string) error) error {
+	if builtinDirectives[fn] {
 		return fmt.Errorf("validate: error supplied function %s matches built in name", fn)
 	}
 
-	if userFns == nil {
-		userFns = &validatorFunctions{}
+	if validateFn != nil {
+		vd.fns.Lock()
+		if vd.fns.Funcs == nil {
+			vd.fns.Funcs = map[string]func(string) error{}
+		}
+		vd.fns.Funcs[fn] = validateFn
+		delete(vd.fns.ArgFuncs, fn)
+		delete(vd.fns.Validaters, fn)
+		delete(vd.fns.Transforms, fn)
+		vd.fns.Unlock()
+		vd.ClearCache()
 	}
+	return nil
+}
 
-	if validateFn != nil {
-		userFns.Lock()
-		if userFns.Funcs == nil {
-			userFns.Funcs = map[string]func(string) error{}
+// AddWithArgs adds a custom directive which takes arguments to the default Validator.
+// See Validator.AddWithArgs.
+func AddWithArgs(fn string, newFn func(args []string) (Validater, error)) error {
+	return std.AddWithArgs(fn, newFn)
+}
+
+// AddWithArgs adds a custom directive which takes arguments, such as divisible(3) or
+// prefix(usr_), to this Validator. When a struct tag using the directive is parsed newFn
+// is called with the arguments split on : the same as range and len, and must return the
+// Validater for that field. An error returned from newFn is reported as a FuncError.
+func (vd *Validator) AddWithArgs(fn string, newFn func(args []string) (Validater, error)) error {
+	if builtinDirectives[fn] {
+		return fmt.Errorf("validate: error supplied function %s matches built in name", fn)
+	}
+
+	if newFn != nil {
+		vd.fns.Lock()
+		if vd.fns.ArgFuncs == nil {
+			vd.fns.ArgFuncs = map[string]func([]string) (Validater, error){}
+		}
+		vd.fns.ArgFuncs[fn] = newFn
+		delete(vd.fns.Funcs, fn)
+		delete(vd.fns.Validaters, fn)
+		delete(vd.fns.Transforms, fn)
+		vd.fns.Unlock()
+		vd.ClearCache()
+	}
+	return nil
+}
+
+// AddValidater adds a custom Validater to the default Validator. See Validator.AddValidater.
+func AddValidater(fn string, validater Validater) error {
+	return std.AddValidater(fn, validater)
+}
+
+// AddTyped adds a custom validation function for values of type T to the default Validator,
+// for example AddTyped[int64]("even", isEven). See Typed.
+func AddTyped[T any](fn string, validateFn func(T) error) error {
+	return std.AddValidater(fn, Typed(validateFn))
+}
+
+// AddValidater adds a custom Validater to this Validator. Unlike functions added with Add,
+// which are passed a string, the Validater is passed the value after it has been parsed in
+// to its Go type (int64 for int fields, uint64 for uint fields, float64 for floats, the
+// converted value for fields with a converter). If the Validater is a TypedValidater
+// it is checked against the type of each field it is used on when the tag is parsed.
+func (vd *Validator) AddValidater(fn string, validater Validater) error {
+	if builtinDirectives[fn] {
+		return fmt.Errorf("validate: error supplied function %s matches built in name", fn)
+	}
+
+	if validater != nil {
+		vd.fns.Lock()
+		if vd.fns.Validaters == nil {
+			vd.fns.Validaters = map[string]Validater{}
 		}
-		userFns.Funcs[fn] = validateFn
-		userFns.Unlock()
+		vd.fns.Validaters[fn] = validater
+		delete(vd.fns.Funcs, fn)
+		delete(vd.fns.ArgFuncs, fn)
+		delete(vd.fns.Transforms, fn)
+		vd.fns.Unlock()
+		vd.ClearCache()
 	}
 	return nil
 }
 
+// RegisterTransform adds a transform directive to the default Validator. See Validator.RegisterTransform.
+func RegisterTransform(fn string, transformFn func(string) string) error {
+	return std.RegisterTransform(fn, transformFn)
+}
+
+// RegisterTransform adds a transform directive to this Validator. Transforms are run in
+// tag order on each raw value before it is parsed and validated, the same as the built in
+// trim, lower, upper and collapse. For example phone number formatting, or unicode
+// normalization using norm.NFC.String from golang.org/x/text/unicode/norm.
+func (vd *Validator) RegisterTransform(fn string, transformFn func(string) string) error {
+	if builtinDirectives[fn] {
+		return fmt.Errorf("validate: error supplied function %s matches built in name", fn)
+	}
+
+	if transformFn != nil {
+		vd.fns.Lock()
+		if vd.fns.Transforms == nil {
+			vd.fns.Transforms = map[string]func(string) string{}
+		}
+		vd.fns.Transforms[fn] = transformFn
+		delete(vd.fns.Funcs, fn)
+		delete(vd.fns.ArgFuncs, fn)
+		delete(vd.fns.Validaters, fn)
+		vd.fns.Unlock()
+		vd.ClearCache()
+	}
+	return nil
+}
+
+// the built in transform directives.
+var builtinTransforms = map[string]func(string) string{
+	"trim":     strings.TrimSpace,
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"collapse": collapseSpace,
+}
+
+// collapseSpace replaces each run of white space with a single space and removes leading
+// and trailing white space.
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Typed returns a TypedValidater which calls validateFn with values of type T, use it
+// with Validator.AddValidater.
+func Typed[T any](validateFn func(T) error) TypedValidater {
+	return &typedValidate[T]{validateFn: validateFn}
+}
+
+// Remove deletes a custom validater function from the default Validator.
+func Remove(fn string) {
+	std.Remove(fn)
+}
+
+// Remove deletes a custom validater function or transform from this Validator and clears
+// the field cache, structures using the function will return an UnknownDirectiveError.
+func (vd *Validator) Remove(fn string) {
+	vd.fns.Lock()
+	delete(vd.fns.Funcs, fn)
+	delete(vd.fns.ArgFuncs, fn)
+	delete(vd.fns.Validaters, fn)
+	delete(vd.fns.Transforms, fn)
+	vd.fns.Unlock()
+	vd.ClearCache()
+}
+
+// ClearCache empties the field cache of the default Validator.
+func ClearCache() {
+	std.ClearCache()
+}
+
+// ClearCache empties the field cache so struct tags are parsed again the next time they are used.
+func (vd *Validator) ClearCache() {
+	vd.fieldCache.Lock()
+	vd.fieldCache.m = make(map[reflect.Type][]field, 1)
+	vd.fieldCache.generation++
+	vd.fieldCache.Unlock()
+}
+
+// contains our type -> converter mappings.
+type typeConverters struct {
+	sync.RWMutex
+	Funcs map[reflect.Type]func(string) (interface{}, error)
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// RegisterConverter adds a function to the default Validator which converts parameter
+// values in to the Go type typ. Fields of that type (or pointers and slices of it) are
+// assigned using the converter and validators are run against the converted value.
+// The function must return a value assignable to typ. Passing a nil function removes
+// the converter.
+func RegisterConverter(typ reflect.Type, convertFn func(string) (interface{}, error)) {
+	std.RegisterConverter(typ, convertFn)
+}
+
+// RegisterConverter adds a type converter to this Validator only. See the package level RegisterConverter.
+// Registering a converter clears the field cache.
+func (vd *Validator) RegisterConverter(typ reflect.Type, convertFn func(string) (interface{}, error)) {
+	defer vd.ClearCache()
+	vd.converters.Lock()
+	defer vd.converters.Unlock()
+	if convertFn == nil {
+		delete(vd.converters.Funcs, typ)
+		return
+	}
+	if vd.converters.Funcs == nil {
+		vd.converters.Funcs = map[reflect.Type]func(string) (interface{}, error){}
+	}
+	vd.converters.Funcs[typ] = convertFn
+}
+
+// converter looks up how values of a field's type are converted. The field's own type is
+// checked first, so slice types such as net.IP are converted as a single value, then the
+// value type of maps and the element type of slices and arrays. For each, registered
+// converters are checked for the type and the type it points to, after which time.Time,
+// time.Duration and types implementing encoding.TextUnmarshaler are used. Returns the type
+// the converter produces values for and the converter, or nil if the kind based parsing
+// of verifiedAssign should be used.
+func (vd *Validator) converter(typ reflect.Type) (reflect.Type, func(string) (interface{}, error)) {
+	if convertType, fn := vd.typeConverter(typ); fn != nil {
+		return convertType, fn
+	}
+
+	if typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+		if convertType, fn := vd.typeConverter(typ); fn != nil {
+			return convertType, fn
+		}
+	}
+	if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		typ = typ.Elem()
+	}
+	return vd.typeConverter(typ)
+}
+
+// typeConverter returns the converter for typ, or the type it points to, if there is one.
+func (vd *Validator) typeConverter(typ reflect.Type) (reflect.Type, func(string) (interface{}, error)) {
+	vd.converters.RLock()
+	defer vd.converters.RUnlock()
+	if fn := vd.converters.Funcs[typ]; fn != nil {
+		return typ, fn
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+		if fn := vd.converters.Funcs[typ]; fn != nil {
+			return typ, fn
+		}
+	}
+
+	switch typ {
+	case timeType:
+		return typ, timeConverter(time.RFC3339)
+	case durationType:
+		return typ, durationConverter
+	}
+
+	if reflect.PtrTo(typ).Implements(textUnmarshalerType) {
+		return typ, textConverter(typ)
+	}
+	return nil, nil
+}
+
+// textConverter returns a converter which calls UnmarshalText on a new value of typ.
+func textConverter(typ reflect.Type) func(string) (interface{}, error) {
+	return func(s string) (interface{}, error) {
+		v := reflect.New(typ)
+		if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return nil, err
+		}
+		return v.Elem().Interface(), nil
+	}
+}
+
 // setDirectives validates each field individually. Returns TagError if
 // we see the key in the tag as a string but fail to get the value with Get
-func setDirectives(t reflect.StructTag, f *field) error {
+func (vd *Validator) setDirectives(t reflect.StructTag, f *field) error {
 	f.validators = make([]Validater, 0)
 
+	// groups are declared on blank fields, _ struct{} `group:"exactlyone(email|phone)"`.
+	if group := t.Get("group"); group != "" {
+		if f.name != "_" {
+			return &TagError{Tag: "group", Field: f.name}
+		}
+		return parseGroups(group, f)
+	}
+
 	tag := string(t)
 
 	validate := t.Get("validate")
 	if validate == "" && strings.Contains(tag, "validate") {
 		return &TagError{Tag: "validate", Field: f.name}
 	} else {
-		if err := parseValidate(validate, f); err != nil {
+		if err := vd.parseValidate(validate, f); err != nil {
 			return err
 		}
 	}
@@ -132,12 +475,64 @@ func setDirectives(t reflect.StructTag, f *field) error {
 	regex := t.Get("regex")
 	if regex == "" && strings.Contains(tag, "regex") {
 		return &TagError{Tag: "regex", Field: f.name}
-	} else {
+	} else if regex != "" {
 		if err := parseRegex(regex, f); err != nil {
 			return err
 		}
 	}
 
+	// every validator has to be known before the default can be checked.
+	if f.defaults != nil {
+		if err := checkDefault(f); err != nil {
+			return err
+		}
+	}
+
+	keys, keymatch := t.Get("keys"), t.Get("keymatch")
+	if keys == "" && keymatch == "" {
+		return nil
+	}
+	if f.typ.Kind() != reflect.Map {
+		return &FuncTypeError{Func: "keys", Param: f.param, Type: f.typ.Kind().String()}
+	}
+	return vd.parseKeys(keys, keymatch, f)
+}
+
+// parseKeys sets the validators for the keys of a map field. The keys tag takes the
+// same directives as the validate tag (without the parameter name) and keymatch takes
+// a pattern the same as the regex tag.
+func (vd *Validator) parseKeys(keys, keymatch string, f *field) error {
+	kf := &field{name: f.name, typ: f.typ.Key()}
+	if keys != "" {
+		if err := vd.parseValidate(f.param+","+keys, kf); err != nil {
+			return err
+		}
+	}
+	if keymatch != "" {
+		if err := parseRegex(keymatch, kf); err != nil {
+			return err
+		}
+	}
+	f.keys = kf.validators
+	return nil
+}
+
+// checkDefault splits the default value the same as input and assigns it to a new value
+// of the field's type, so a default which doesn't parse or fails the field's validators
+// is found when the tag is compiled rather than when input is missing.
+func checkDefault(f *field) error {
+	if f.typ.Kind() == reflect.Map || f.convert == nil && isNested(elemType(f.typ)) {
+		return &FuncTypeError{Func: "default", Param: f.param, Type: f.typ.Kind().String()}
+	}
+
+	value := strings.Join(f.defaults, "")
+	f.defaults = splitValues(f.defaults, f)
+	if len(f.defaults) == 0 {
+		return &FuncError{Value: value, Type: f.typ.String(), Name: "default"}
+	}
+	if assignValues(f.defaults, f, reflect.New(f.typ).Elem()) != nil {
+		return &FuncError{Value: value, Type: f.typ.String(), Name: "default"}
+	}
 	return nil
 }
 
@@ -162,122 +557,801 @@ func parseRegex(reg string, f *field) error {
 		return err
 	}
 
-	f.validators = append(f.validators, &regexValidate{MatchType: regexType, Pattern: pattern})
+	f.validators = append(f.validators, &regexValidate{MatchType: regexType, Pattern: pattern, Rule: "regex"})
 	return nil
 }
 
 // parses the validate struct tag and sets the field parameter name, whether it is optional
 // and any Validator functions (including user supplied).
-func parseValidate(values string, f *field) error {
-	directives := strings.Split(values, ",")
+func (vd *Validator) parseValidate(values string, f *field) error {
+	directives := splitDirectives(values)
 	if len(directives) <= 0 {
 		return nil
 	}
 
-	kind := f.typ.Kind()
-	if kind == reflect.Slice {
-		kind = f.typ.Elem().Kind()
+	kind := elemType(f.typ).Kind()
+	if f.convert != nil {
+		// fields converted as a single value, such as net.IP, aren't treated as slices.
+		kind = f.convertType.Kind()
 	}
 
 	f.param = directives[0] // first field is always the map key.
+
+	// the layout is needed to parse the arguments of after and before, so find it first.
+	layout := time.RFC3339
+	for i := 1; i < len(directives); i++ {
+		if directiveName(directives[i]) == "layout" {
+			var err error
+			if layout, err = newTimeLayout(directives[i], f); err != nil {
+				return err
+			}
+		}
+	}
+
 	for i := 1; i < len(directives); i++ {
-		if directives[i] == "optional" {
+		switch directiveName(directives[i]) {
+		case "optional":
 			f.optional = true
-		} else if strings.HasPrefix(directives[i], "range") {
-			rangeValidator, err := newRangeValidator(directives[i], "range", f, kind)
+		case "range", "gt", "gte", "lt", "lte":
+			rangeValidator, err := newRangeValidator(directives[i], directiveName(directives[i]), f, kind)
 			if err != nil {
 				return err
 			}
 
-			f.validators = append(f.validators, rangeValidator)
+			f.validators = append(f.validators, rangeValidator)
+		case "len", "bytelen", "runelen", "graphemelen":
+			lenValidator, err := newLenValidator(directives[i], directiveName(directives[i]), f, kind, vd.lengthMode)
+			if err != nil {
+				return err
+			}
+			f.validators = append(f.validators, lenValidator)
+		case "oneof", "oneofci":
+			oneOfValidator, err := newOneOfValidator(directives[i], directiveName(directives[i]), f, kind)
+			if err != nil {
+				return err
+			}
+			f.validators = append(f.validators, oneOfValidator)
+		case "count", "minitems", "maxitems":
+			countValidator, err := newCountValidator(directives[i], directiveName(directives[i]), f)
+			if err != nil {
+				return err
+			}
+			f.counts = append(f.counts, countValidator)
+		case "unique":
+			if !isSlice(f.typ) || convertsWhole(f) {
+				return &FuncTypeError{Func: "unique", Param: f.param, Type: f.typ.Kind().String()}
+			}
+			f.unique = true
+		case "partial":
+			typ := f.typ
+			if typ.Kind() == reflect.Map {
+				typ = typ.Elem()
+			}
+			if typ.Kind() != reflect.Array || convertsWhole(f) {
+				return &FuncTypeError{Func: "partial", Param: f.param, Type: f.typ.Kind().String()}
+			}
+			f.partial = true
+		case "split":
+			if !isSlice(f.typ) || convertsWhole(f) {
+				return &FuncTypeError{Func: "split", Param: f.param, Type: f.typ.Kind().String()}
+			}
+			sep, err := directiveArgs(directives[i], "split")
+			if err != nil {
+				return err
+			}
+			if sep == "" {
+				return &FuncError{Value: sep, Type: f.typ.Kind().String(), Name: "split"}
+			}
+			f.split = sep
+		case "trim", "lower", "upper", "collapse":
+			// transforms don't take arguments.
+			if directives[i] != directiveName(directives[i]) {
+				return &FuncError{Value: directives[i], Type: f.typ.Kind().String(), Name: directiveName(directives[i])}
+			}
+			f.transforms = append(f.transforms, builtinTransforms[directiveName(directives[i])])
+		case "default":
+			value, err := directiveArgs(directives[i], "default")
+			if err != nil {
+				return err
+			}
+			if value == "" {
+				return &FuncError{Value: directives[i], Type: f.typ.Kind().String(), Name: "default"}
+			}
+			f.defaults = []string{value}
+			f.optional = true
+		case "eqfield", "nefield", "gtfield", "gtefield", "ltfield", "ltefield":
+			name, err := directiveArgs(directives[i], directiveName(directives[i]))
+			if err != nil {
+				return err
+			}
+			if name == "" {
+				return &FuncError{Value: directives[i], Type: f.typ.Kind().String(), Name: directiveName(directives[i])}
+			}
+			f.compares = append(f.compares, fieldCompare{Rule: directives[i], Op: directiveName(directives[i]), Field: name})
+		case "required_if", "required_with", "required_without", "excluded_if":
+			c, err := newCondition(directives[i], directiveName(directives[i]), f)
+			if err != nil {
+				return err
+			}
+			f.conditions = append(f.conditions, c)
+			// whether the field is required is decided by its conditions.
+			f.optional = true
+		case "layout":
+			// parsed above.
+		case "after", "before":
+			timeValidator, err := newTimeBoundValidator(directives[i], directiveName(directives[i]), f, layout)
+			if err != nil {
+				return err
+			}
+			f.validators = append(f.validators, timeValidator)
+		case "within":
+			withinValidator, err := newWithinValidator(directives[i], "within", f)
+			if err != nil {
+				return err
+			}
+			f.validators = append(f.validators, withinValidator)
+		default:
+			// check custom user functions, they are looked up again by name when validating.
+			vd.fns.RLock()
+			validateFn := vd.fns.Funcs[directives[i]]
+			newFn := vd.fns.ArgFuncs[directiveName(directives[i])]
+			validater := vd.fns.Validaters[directives[i]]
+			transformFn := vd.fns.Transforms[directives[i]]
+			vd.fns.RUnlock()
+			if transformFn != nil {
+				f.transforms = append(f.transforms, transformFn)
+				continue
+			}
+			if validater != nil {
+				if err := checkValueType(directives[i], validater, f); err != nil {
+					return err
+				}
+				f.validators = append(f.validators, &userValidate{Name: directives[i], Field: f.name, fns: vd.fns})
+				continue
+			}
+			if newFn != nil {
+				argsValidator, err := newUserArgsValidator(directives[i], newFn, kind)
+				if err != nil {
+					return err
+				}
+				f.validators = append(f.validators, argsValidator)
+				continue
+			}
+			if validateFn == nil {
+				return &UnknownDirectiveError{Field: f.name, Directive: directives[i]}
+			}
+			f.validators = append(f.validators, &userValidate{Name: directives[i], Field: f.name, fns: vd.fns})
+		}
+	}
+	return nil
+}
+
+// splitDirectives splits the validate tag on commas. Commas inside of a directive's
+// arguments are kept, the arguments end at a ) which is followed by a comma or the end
+// of the tag. This allows directives such as layout(Jan 2, 2006).
+func splitDirectives(values string) []string {
+	directives := make([]string, 0, 4)
+	start, inArgs := 0, false
+	for i := 0; i < len(values); i++ {
+		switch values[i] {
+		case '(':
+			inArgs = true
+		case ')':
+			if i+1 == len(values) || values[i+1] == ',' {
+				inArgs = false
+			}
+		case ',':
+			if !inArgs {
+				directives = append(directives, values[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(directives, values[start:])
+}
+
+// directiveName returns the name of the directive without any arguments, range(1:2) returns range.
+func directiveName(directive string) string {
+	if i := strings.Index(directive, "("); i != -1 {
+		return directive[:i]
+	}
+	return directive
+}
+
+// directiveArgs returns everything between the first ( and last ) of the directive.
+func directiveArgs(directive, fname string) (string, error) {
+	open := strings.Index(directive, "(")
+	end := strings.LastIndex(directive, ")")
+	if open == -1 || end < open {
+		return "", fmt.Errorf("validate: missing arguments to %s validator function", fname)
+	}
+	return directive[open+1 : end], nil
+}
+
+// elemType returns the type validators will see for a field, the value type of maps,
+// the element type of slices and arrays and the type pointed to by pointers.
+func elemType(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+// isSlice returns true for fields holding a list of values, slices, arrays and maps of either.
+func isSlice(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array
+}
+
+// parseGroups parses the directives of a group tag, each of exactlyone, atmostone and
+// atleastone take two or more | separated parameters, atmostone(card|bank).
+func parseGroups(values string, f *field) error {
+	for _, directive := range splitDirectives(values) {
+		name := directiveName(directive)
+		if name != "exactlyone" && name != "atmostone" && name != "atleastone" {
+			return &UnknownDirectiveError{Field: f.name, Directive: directive}
+		}
+		args, err := directiveArgs(directive, name)
+		if err != nil {
+			return err
+		}
+		members := strings.Split(args, "|")
+		if len(members) < 2 {
+			return &FuncError{Value: directive, Type: "group", Name: name}
+		}
+		f.groups = append(f.groups, fieldGroup{Rule: directive, Op: name, Members: members})
+	}
+	return nil
+}
+
+// resolveGroups finds the field of each member of the groups declared at depth level,
+// prefix is the parameter prefix of the structure. Returns a FuncError if no field has
+// the parameter.
+func resolveGroups(fields []field, level int, prefix string) []error {
+	var errs []error
+	for i := range fields {
+		f := &fields[i]
+		if len(f.index) != level {
+			continue
+		}
+		for j := range f.groups {
+			g := &f.groups[j]
+			g.index = make([][]int, 0, len(g.Members))
+			for _, member := range g.Members {
+				other := -1
+				for k := range fields {
+					if fields[k].param != "" && fields[k].param == prefix+member {
+						other = k
+					}
+				}
+				if other == -1 {
+					errs = append(errs, &FuncError{Value: member, Type: "group", Name: g.Op})
+					break
+				}
+				// presence is decided by the member's own parameter, which maps and slices
+				// of structures don't have.
+				if fields[other].elems != nil || fields[other].typ.Kind() == reflect.Map {
+					errs = append(errs, &FuncTypeError{Func: g.Op, Param: fields[other].param, Type: fields[other].typ.String()})
+					break
+				}
+				g.index = append(g.index, fields[other].index)
+			}
+		}
+	}
+	return errs
+}
+
+// newCondition parses a conditional presence directive. required_if and excluded_if take
+// a parameter and the | separated values which trigger them, required_if(method=card|bank),
+// required_with and required_without take | separated parameters, required_with(street).
+func newCondition(input, fname string, f *field) (condition, error) {
+	args, err := directiveArgs(input, fname)
+	if err != nil {
+		return condition{}, err
+	}
+
+	c := condition{Rule: input, Op: fname}
+	if fname == "required_if" || fname == "excluded_if" {
+		i := strings.Index(args, "=")
+		if i <= 0 {
+			return c, &FuncError{Value: input, Type: f.typ.Kind().String(), Name: fname}
+		}
+		c.Params = []string{args[:i]}
+		c.Values = strings.Split(args[i+1:], "|")
+		return c, nil
+	}
+
+	if args == "" {
+		return c, &FuncError{Value: input, Type: f.typ.Kind().String(), Name: fname}
+	}
+	c.Params = strings.Split(args, "|")
+	return c, nil
+}
+
+// resolveConditions finds the field of each parameter named by the conditions of the
+// fields at depth level, prefix is the parameter prefix of the structure. Returns a
+// FuncError if no field has the parameter and a FuncTypeError if the condition is used
+// on, or names, a map or slice of structures.
+func resolveConditions(fields []field, level int, prefix string) []error {
+	var errs []error
+	for i := range fields {
+		f := &fields[i]
+		if len(f.index) != level || len(f.conditions) == 0 {
+			continue
+		}
+		if f.elems != nil || f.typ.Kind() == reflect.Map {
+			errs = append(errs, &FuncTypeError{Func: f.conditions[0].Op, Param: f.param, Type: f.typ.String()})
+			continue
+		}
+		for j := range f.conditions {
+			c := &f.conditions[j]
+			c.index = make([][]int, 0, len(c.Params))
+			for _, param := range c.Params {
+				other := -1
+				for k := range fields {
+					if fields[k].param == prefix+param && k != i {
+						other = k
+					}
+				}
+				if other == -1 {
+					errs = append(errs, &FuncError{Value: param, Type: f.typ.String(), Name: c.Op})
+					break
+				}
+				if fields[other].elems != nil || fields[other].typ.Kind() == reflect.Map {
+					errs = append(errs, &FuncTypeError{Func: c.Op, Param: f.param, Type: fields[other].typ.String()})
+					break
+				}
+				c.index = append(c.index, fields[other].index)
+			}
+		}
+	}
+	return errs
+}
+
+// resolveCompares finds the sibling field of each cross field comparison of the fields
+// at depth level, fields of nested structures have already been resolved. Returns a
+// FuncError if the sibling doesn't exist (or has no validate tag) and a FuncTypeError
+// if the two fields can't be compared.
+func resolveCompares(fields []field, level int) []error {
+	var errs []error
+	for i := range fields {
+		f := &fields[i]
+		if len(f.index) != level {
+			continue
+		}
+		for j := range f.compares {
+			c := &f.compares[j]
+			other := -1
+			for k := range fields {
+				if len(fields[k].index) == level && fields[k].name == c.Field && fields[k].param != "" {
+					other = k
+				}
+			}
+			if other == -1 || other == i {
+				errs = append(errs, &FuncError{Value: c.Field, Type: f.typ.String(), Name: c.Op})
+				continue
+			}
+			if err := checkCompare(c, f, &fields[other]); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			c.index = fields[other].index
+		}
+	}
+	return errs
+}
+
+// checkCompare returns a FuncTypeError unless both fields hold single values of the same
+// type, which must be ordered (numbers, strings and times) for anything but eqfield and nefield.
+func checkCompare(c *fieldCompare, f, other *field) error {
+	if !isComparable(f) || !isComparable(other) || valueType(f) != valueType(other) {
+		return &FuncTypeError{Func: c.Op, Param: f.param, Type: other.typ.String()}
+	}
+	if c.Op == "eqfield" || c.Op == "nefield" {
+		return nil
+	}
+
+	typ := valueType(f)
+	switch kindClass(typ.Kind()) {
+	case reflect.Int64, reflect.Uint64, reflect.Float64, reflect.String:
+		return nil
+	}
+	if typ == timeType {
+		return nil
+	}
+	return &FuncTypeError{Func: c.Op, Param: f.param, Type: typ.String()}
+}
+
+// isComparable returns true if the field holds a single value which supports ==.
+func isComparable(f *field) bool {
+	typ := f.typ
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return false
+	}
+	return valueType(f).Comparable()
+}
+
+// convertsWhole returns true if the field's own type is converted as a single value, such
+// as net.IP, rather than being a list of converted values.
+func convertsWhole(f *field) bool {
+	if f.convert == nil {
+		return false
+	}
+	return f.convertType == f.typ || f.typ.Kind() == reflect.Ptr && f.convertType == f.typ.Elem()
+}
+
+// newLenValidator validates the length of a string. len measures strings according to
+// mode, bytelen, runelen and graphemelen always count bytes, runes and graphemes.
+func newLenValidator(input, fname string, f *field, kind reflect.Kind, mode LengthMode) (Validater, error) {
+	// len only works on strings.
+	if kind != reflect.String {
+		return nil, &FuncTypeError{Func: fname, Param: f.param, Type: kind.String()}
+	}
+
+	switch fname {
+	case "bytelen":
+		mode = ByteLength
+	case "runelen":
+		mode = RuneLength
+	case "graphemelen":
+		mode = GraphemeLength
+	}
+
+	min, max, b, err := getBounds(input, fname)
+	if err != nil {
+		return nil, err
+	}
+	min, max = fillBounds(min, max)
+
+	nmin, err := strconv.Atoi(min)
+	if err != nil {
+		return nil, &FuncError{Value: min, Type: kind.String(), Name: fname}
+	}
+	nmax, err := strconv.Atoi(max)
+	if err != nil {
+		return nil, &FuncError{Value: max, Type: kind.String(), Name: fname}
+	}
+	if nmax < nmin {
+		return nil, &FuncError{Value: "max " + max + " < " + min + " min", Type: kind.String(), Name: fname}
+	}
+	if b.empty(nmin == nmax) {
+		return nil, &FuncError{Value: "empty range " + input, Type: kind.String(), Name: fname}
+	}
+
+	return &lenValidate{Min: nmin, Max: nmax, Rule: input, Mode: mode, bounds: b}, nil
+}
+
+// newRangeValidator validates that a numerical value falls with in the specified range.
+// Also used for gt, gte, lt and lte which are ranges open on one end.
+func newRangeValidator(input, fname string, f *field, kind reflect.Kind) (Validater, error) {
+	// can't do ranges on strings.
+	if kind == reflect.String {
+		return nil, &FuncTypeError{Func: fname, Param: f.param, Type: kind.String()}
+	}
+	min, max, b, err := getBounds(input, fname)
+	if err != nil {
+		return nil, err
+	}
+	min, max = fillBounds(min, max)
+
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if elemType(f.typ) == durationType {
+			nmin, nmax, errDuration := durationFuncArguments(min, max, fname)
+			if errDuration != nil {
+				return nil, errDuration
+			}
+			if b.empty(nmin == nmax) {
+				return nil, &FuncError{Value: "empty range " + input, Type: "Duration", Name: fname}
+			}
+			return &rangeIntValidate{Min: int64(nmin), Max: int64(nmax), Rule: input, bounds: b, duration: true}, nil
+		}
+		nmin, nmax, errInt := intFuncArguments(min, max, fname)
+		if errInt != nil {
+			return nil, errInt
+		}
+		if b.empty(nmin == nmax) {
+			return nil, &FuncError{Value: "empty range " + input, Type: "Int", Name: fname}
+		}
+		return &rangeIntValidate{Min: nmin, Max: nmax, Rule: input, bounds: b}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		nmin, nmax, errUint := uintFuncArguments(min, max, fname)
+		if errUint != nil {
+			return nil, errUint
+		}
+		if b.empty(nmin == nmax) {
+			return nil, &FuncError{Value: "empty range " + input, Type: "Uint", Name: fname}
+		}
+		return &rangeUintValidate{Min: nmin, Max: nmax, Rule: input, bounds: b}, nil
+	case reflect.Float32, reflect.Float64:
+		nmin, nmax, errFloat := floatFuncArguments(min, max, fname)
+		if errFloat != nil {
+			return nil, errFloat
+		}
+		if b.empty(nmin == nmax) {
+			return nil, &FuncError{Value: "empty range " + input, Type: "Float", Name: fname}
+		}
+		return &rangeFloatValidate{Min: nmin, Max: nmax, Rule: input, bounds: b}, nil
+	default:
+		return nil, fmt.Errorf("validate: error %s is not a supported type for function %s.", kind.String(), fname)
+	}
+}
+
+// newCountValidator validates the number of values submitted for a slice or array field,
+// or the number of entries of a map field, count(1:10), minitems(1) or maxitems(10).
+// Array fields always reject more values than their length.
+func newCountValidator(input, fname string, f *field) (Validater, error) {
+	if f.typ.Kind() != reflect.Slice && f.typ.Kind() != reflect.Array && f.typ.Kind() != reflect.Map || convertsWhole(f) {
+		return nil, &FuncTypeError{Func: fname, Param: f.param, Type: f.typ.Kind().String()}
+	}
+
+	var min, max string
+	var b bounds
+	var err error
+	switch fname {
+	case "minitems":
+		min, max, b, err = getBounds(input, "gte")
+	case "maxitems":
+		min, max, b, err = getBounds(input, "lte")
+	default:
+		min, max, b, err = getBounds(input, fname)
+	}
+	if err != nil {
+		return nil, err
+	}
+	min, max = fillBounds(min, max)
+
+	nmin, nmax, err := uintFuncArguments(min, max, fname)
+	if err != nil {
+		return nil, err
+	}
+	if b.empty(nmin == nmax) {
+		return nil, &FuncError{Value: "empty range " + input, Type: "Uint", Name: fname}
+	}
+	return &countValidate{Min: int(nmin), Max: int(nmax), Rule: input, bounds: b}, nil
+}
+
+// bounds records which ends of a range or len are open or exclusive. The zero
+// value is a range which includes both min and max.
+type bounds struct {
+	NoMin        bool // there is no lower limit.
+	NoMax        bool // there is no upper limit.
+	MinExclusive bool // the value must be greater than min.
+	MaxExclusive bool // the value must be less than max.
+}
+
+// empty returns true if no value can be within the bounds, (1:1] for example.
+func (b bounds) empty(equal bool) bool {
+	return equal && !b.NoMin && !b.NoMax && (b.MinExclusive || b.MaxExclusive)
+}
+
+// inBounds returns true if val is within min and max according to b.
+func inBounds[T int | int64 | uint64 | float64](val, min, max T, b bounds) bool {
+	if !b.NoMin && (val < min || (b.MinExclusive && val == min)) {
+		return false
+	}
+	if !b.NoMax && (val > max || (b.MaxExclusive && val == max)) {
+		return false
+	}
+	return true
+}
+
+// getBounds returns the min and max arguments of range and len, either of which may be
+// left empty for no limit, range(18:) or len(:255). Surrounding the arguments with ( or )
+// makes that end exclusive, while [ or ] is inclusive, range((0:1]). gt, gte, lt and lte
+// take a single argument for one end.
+func getBounds(data, fname string) (string, string, bounds, error) {
+	var b bounds
+	r, err := directiveArgs(data, fname)
+	if err != nil {
+		return "", "", b, err
+	}
+
+	switch fname {
+	case "gt", "gte":
+		b.NoMax, b.MinExclusive = true, fname == "gt"
+		if r == "" || strings.Contains(r, ":") {
+			return "", "", b, fmt.Errorf("validate: invalid number of arguments to %s validator function", fname)
+		}
+		return r, "", b, nil
+	case "lt", "lte":
+		b.NoMin, b.MaxExclusive = true, fname == "lt"
+		if r == "" || strings.Contains(r, ":") {
+			return "", "", b, fmt.Errorf("validate: invalid number of arguments to %s validator function", fname)
+		}
+		return "", r, b, nil
+	}
+
+	if len(r) >= 2 && strings.ContainsAny(r[:1], "([") && strings.ContainsAny(r[len(r)-1:], ")]") {
+		b.MinExclusive = r[0] == '('
+		b.MaxExclusive = r[len(r)-1] == ')'
+		r = r[1 : len(r)-1]
+	}
+
+	vals := strings.Split(r, ":")
+	if len(vals) != 2 || (vals[0] == "" && vals[1] == "") {
+		return "", "", b, fmt.Errorf("validate: invalid number of arguments to %s validator function", fname)
+	}
+	b.NoMin, b.NoMax = vals[0] == "", vals[1] == ""
+	return vals[0], vals[1], b, nil
+}
+
+// fillBounds replaces an open end with the other so the min and max can be parsed
+// by the FuncArguments functions, the open end is ignored when validating.
+func fillBounds(min, max string) (string, string) {
+	if min == "" {
+		min = max
+	}
+	if max == "" {
+		max = min
+	}
+	return min, max
+}
 
-		} else if strings.HasPrefix(directives[i], "len") {
-			lenValidator, err := newLenValidator(directives[i], "len", f, kind)
-			if err != nil {
-				return err
-			}
-			f.validators = append(f.validators, lenValidator)
-		} else {
-			// check custom user functions
-			if userFns != nil {
-				userFns.RLock()
-				if userFns.Funcs[directives[i]] != nil {
-					userValidator := &userValidate{validateFn: userFns.Funcs[directives[i]]}
-					f.validators = append(f.validators, userValidator)
-				}
-				userFns.RUnlock()
-			} else {
-				return fmt.Errorf("validate: error unknown validation function %s\n", directives[i])
-			}
+// newUserArgsValidator calls a function added with AddWithArgs with the directive's
+// arguments. Directives used without parentheses get no arguments.
+func newUserArgsValidator(input string, newFn func([]string) (Validater, error), kind reflect.Kind) (Validater, error) {
+	fname := directiveName(input)
+	args := make([]string, 0)
+	if fname != input {
+		r, err := directiveArgs(input, fname)
+		if err != nil {
+			return nil, err
+		}
+		if r != "" {
+			args = strings.Split(r, ":")
 		}
 	}
-	return nil
+
+	validater, err := newFn(args)
+	if err != nil {
+		if _, ok := err.(*FuncError); ok {
+			return nil, err
+		}
+		return nil, &FuncError{Value: strings.Join(args, ":") + " (" + err.Error() + ")", Type: kind.String(), Name: fname}
+	}
+	if validater == nil {
+		return nil, &FuncError{Value: strings.Join(args, ":"), Type: kind.String(), Name: fname}
+	}
+	return &ruleValidate{Rule: input, validater: validater}, nil
 }
 
-// newLenValidator validates the length of a string.
-func newLenValidator(input, fname string, f *field, kind reflect.Kind) (Validater, error) {
-	// len only works on strings.
-	if kind != reflect.String {
-		return nil, &FuncTypeError{Func: "len", Param: f.param, Type: kind.String()}
+// valueType returns the type of value verifiedAssign passes to the field's validators.
+func valueType(f *field) reflect.Type {
+	if f.convert != nil {
+		return f.convertType
 	}
 
-	min, max, err := getArguments(input, fname)
-	if err != nil {
-		return nil, err
+	switch elemType(f.typ).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.TypeOf(int64(0))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return reflect.TypeOf(uint64(0))
+	case reflect.Float32, reflect.Float64:
+		return reflect.TypeOf(float64(0))
+	case reflect.String:
+		return reflect.TypeOf("")
+	case reflect.Bool:
+		return reflect.TypeOf(false)
 	}
+	return elemType(f.typ)
+}
 
-	nmin, err := strconv.Atoi(min)
-	if err != nil {
-		return nil, &FuncError{Value: min, Type: kind.String(), Name: fname}
+// kindClass groups kinds which a TypedValidater's value may be converted between.
+func kindClass(kind reflect.Kind) reflect.Kind {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.Int64
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return reflect.Uint64
+	case reflect.Float32, reflect.Float64:
+		return reflect.Float64
 	}
-	nmax, err := strconv.Atoi(max)
-	if err != nil {
-		return nil, &FuncError{Value: max, Type: kind.String(), Name: fname}
+	return kind
+}
+
+// checkValueType returns a FuncTypeError if the validater is a TypedValidater and the
+// field can't produce a value of its type.
+func checkValueType(fname string, validater Validater, f *field) error {
+	typed, ok := validater.(TypedValidater)
+	if !ok {
+		return nil
 	}
-	if nmax < nmin {
-		return nil, &FuncError{Value: "max " + max + " < " + min + " min", Type: kind.String(), Name: fname}
+
+	have, want := valueType(f), typed.ValueType()
+	if have.AssignableTo(want) {
+		return nil
 	}
+	if have.ConvertibleTo(want) && kindClass(have.Kind()) == kindClass(want.Kind()) && !narrows(f, want) {
+		return nil
+	}
+	return &FuncTypeError{Func: fname, Param: f.param, Type: elemType(f.typ).String()}
+}
 
-	return &lenValidate{Min: nmin, Max: nmax}, nil
+// narrows reports whether a numeric want type is too small to hold every value of the
+// field, such as an int8 validater on an int64 field which would see 300 as 44.
+func narrows(f *field, want reflect.Type) bool {
+	typ := elemType(f.typ)
+	if f.convert != nil {
+		typ = f.convertType
+	}
+	switch kindClass(want.Kind()) {
+	case reflect.Int64, reflect.Uint64, reflect.Float64:
+		return want.Bits() < typ.Bits()
+	}
+	return false
 }
 
-// newRangeValidator validates that a numerical value falls with in the specified range.
-func newRangeValidator(input, fname string, f *field, kind reflect.Kind) (Validater, error) {
-	// can't do ranges on strings.
-	if kind == reflect.String {
-		return nil, &FuncTypeError{Func: "range", Param: f.param, Type: kind.String()}
+// newOneOfValidator validates a value is one of the | separated arguments, oneof(a|b|c).
+// oneofci compares strings case insensitively.
+func newOneOfValidator(input, fname string, f *field, kind reflect.Kind) (Validater, error) {
+	switch kindClass(kind) {
+	case reflect.String:
+	case reflect.Int64, reflect.Uint64, reflect.Float64:
+		if fname == "oneofci" {
+			return nil, &FuncTypeError{Func: fname, Param: f.param, Type: kind.String()}
+		}
+	default:
+		return nil, &FuncTypeError{Func: fname, Param: f.param, Type: kind.String()}
 	}
-	min, max, err := getArguments(input, fname)
+
+	r, err := directiveArgs(input, fname)
 	if err != nil {
 		return nil, err
 	}
+	if r == "" {
+		return nil, &FuncError{Value: r, Type: kind.String(), Name: fname}
+	}
 
-	switch kind {
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		nmin, nmax, errInt := intFuncArguments(min, max, fname)
-		if errInt != nil {
-			return nil, errInt
-		}
-		return &rangeIntValidate{Min: nmin, Max: nmax}, nil
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		nmin, nmax, errUint := uintFuncArguments(min, max, fname)
-		if errUint != nil {
-			return nil, errUint
+	// floats are parsed at the precision of the field so float32 values compare equal.
+	typ := elemType(f.typ)
+	if f.convert != nil {
+		typ = f.convertType
+	}
+
+	allowed := strings.Split(r, "|")
+	o := &oneOfValidate{Rule: input, Allowed: allowed, Fold: fname == "oneofci", Values: make(map[interface{}]bool, len(allowed))}
+	for _, a := range allowed {
+		var value interface{}
+		var err error
+		switch kindClass(kind) {
+		case reflect.Int64:
+			value, err = strconv.ParseInt(a, 10, 64)
+		case reflect.Uint64:
+			value, err = strconv.ParseUint(a, 10, 64)
+		case reflect.Float64:
+			value, err = strconv.ParseFloat(a, typ.Bits())
+		default:
+			if o.Fold {
+				a = strings.ToLower(a)
+			}
+			value = a
 		}
-		return &rangeUintValidate{Min: nmin, Max: nmax}, nil
-	case reflect.Float32, reflect.Float64:
-		nmin, nmax, errFloat := floatFuncArguments(min, max, fname)
-		if errFloat != nil {
-			return nil, errFloat
+		if err != nil {
+			return nil, &FuncError{Value: a, Type: kind.String(), Name: fname}
 		}
-		return &rangeFloatValidate{Min: nmin, Max: nmax}, nil
-	default:
-		return nil, fmt.Errorf("validate: error %s is not a supported type for function %s.", kind.String(), fname)
+		o.Values[value] = true
 	}
+	return o, nil
 }
 
 func getArguments(data, fname string) (string, string, error) {
-	r := data[strings.Index(data, "(")+1 : strings.Index(data, ")")]
+	r, err := directiveArgs(data, fname)
+	if err != nil {
+		return "", "", err
+	}
 	vals := strings.Split(r, ":")
 	if len(vals) != 2 {
 		return "", "", fmt.Errorf("validate: invalid number of arguments to %s validator function", fname)
@@ -332,65 +1406,397 @@ func floatFuncArguments(min, max, fname string) (float64, float64, error) {
 	return nmin, nmax, nil
 }
 
+func durationFuncArguments(min, max, fname string) (time.Duration, time.Duration, error) {
+	nmin, err := time.ParseDuration(min)
+	if err != nil {
+		return 0, 0, &FuncError{Value: min, Type: "Duration", Name: fname}
+	}
+	nmax, err := time.ParseDuration(max)
+	if err != nil {
+		return 0, 0, &FuncError{Value: max, Type: "Duration", Name: fname}
+	}
+	if nmax < nmin {
+		return 0, 0, &FuncError{Value: "max " + max + " < " + min + " min", Type: "Duration", Name: fname}
+	}
+	return nmin, nmax, nil
+}
+
+// named layouts which may be used in place of a Go layout string, layout(date).
+var timeLayouts = map[string]string{
+	"ansic":       time.ANSIC,
+	"unixdate":    time.UnixDate,
+	"rfc822":      time.RFC822,
+	"rfc822z":     time.RFC822Z,
+	"rfc850":      time.RFC850,
+	"rfc1123":     time.RFC1123,
+	"rfc1123z":    time.RFC1123Z,
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"kitchen":     time.Kitchen,
+	"datetime":    time.DateTime,
+	"date":        time.DateOnly,
+	"time":        time.TimeOnly,
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// newTimeLayout sets the field to parse time values using the layout given to the
+// layout directive, either a named layout or a Go reference time layout.
+func newTimeLayout(input string, f *field) (string, error) {
+	if elemType(f.typ) != timeType {
+		return "", &FuncTypeError{Func: "layout", Param: f.param, Type: elemType(f.typ).String()}
+	}
+
+	layout, err := directiveArgs(input, "layout")
+	if err != nil {
+		return "", err
+	}
+	if named, ok := timeLayouts[layout]; ok {
+		layout = named
+	}
+	if layout == "" {
+		return "", &FuncError{Value: layout, Type: "Time", Name: "layout"}
+	}
+
+	f.convertType, f.convert = timeType, timeConverter(layout)
+	return layout, nil
+}
+
+// timeConverter returns a converter which parses times with the layout.
+func timeConverter(layout string) func(string) (interface{}, error) {
+	return func(s string) (interface{}, error) {
+		return time.Parse(layout, s)
+	}
+}
+
+// durationConverter parses durations such as 1h30m.
+func durationConverter(s string) (interface{}, error) {
+	return time.ParseDuration(s)
+}
+
+// parseTimeArgument parses the argument to after or before, either now or a time in the
+// field's layout, RFC3339 or date form.
+func parseTimeArgument(arg, layout, fname string) (time.Time, bool, error) {
+	if arg == "now" {
+		return time.Time{}, true, nil
+	}
+	for _, l := range []string{layout, time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(l, arg); err == nil {
+			return t, false, nil
+		}
+	}
+	return time.Time{}, false, &FuncError{Value: arg, Type: "Time", Name: fname}
+}
+
+// newTimeBoundValidator validates a time is after or before a fixed time or now.
+func newTimeBoundValidator(input, fname string, f *field, layout string) (Validater, error) {
+	if elemType(f.typ) != timeType {
+		return nil, &FuncTypeError{Func: fname, Param: f.param, Type: elemType(f.typ).String()}
+	}
+
+	arg, err := directiveArgs(input, fname)
+	if err != nil {
+		return nil, err
+	}
+	t, now, err := parseTimeArgument(arg, layout, fname)
+	if err != nil {
+		return nil, err
+	}
+	return &timeBoundValidate{Time: t, Now: now, Before: fname == "before", Rule: input}, nil
+}
+
+// newWithinValidator validates a time falls within a window relative to now, within(-24h:1h).
+func newWithinValidator(input, fname string, f *field) (Validater, error) {
+	if elemType(f.typ) != timeType {
+		return nil, &FuncTypeError{Func: fname, Param: f.param, Type: elemType(f.typ).String()}
+	}
+
+	min, max, err := getArguments(input, fname)
+	if err != nil {
+		return nil, err
+	}
+	nmin, nmax, err := durationFuncArguments(min, max, fname)
+	if err != nil {
+		return nil, err
+	}
+	return &withinValidate{Min: nmin, Max: nmax, Rule: input}, nil
+}
+
 type rangeIntValidate struct {
-	Min int64
-	Max int64
+	bounds
+	Rule     string
+	Min      int64
+	Max      int64
+	duration bool // the field is a time.Duration, failing values are reported as 30s.
 }
 
 func (r *rangeIntValidate) Validate(param string, value interface{}) error {
 	v := reflect.ValueOf(value)
 	val := v.Int()
-	if val < r.Min || val > r.Max {
-		return &ValidationError{Param: param, Value: strconv.FormatInt(val, 10)}
+	if !inBounds(val, r.Min, r.Max, r.bounds) {
+		if r.duration {
+			return &ValidationError{Param: param, Value: time.Duration(val).String(), Rule: r.Rule}
+		}
+		return &ValidationError{Param: param, Value: strconv.FormatInt(val, 10), Rule: r.Rule}
 	}
 	return nil
 }
 
 type rangeUintValidate struct {
-	Min uint64
-	Max uint64
+	bounds
+	Rule string
+	Min  uint64
+	Max  uint64
 }
 
 func (r *rangeUintValidate) Validate(param string, value interface{}) error {
 	v := reflect.ValueOf(value)
 	val := v.Uint()
-	if val < r.Min || val > r.Max {
-		return &ValidationError{Param: param, Value: strconv.FormatUint(val, 10)}
+	if !inBounds(val, r.Min, r.Max, r.bounds) {
+		return &ValidationError{Param: param, Value: strconv.FormatUint(val, 10), Rule: r.Rule}
 	}
 	return nil
 }
 
 type rangeFloatValidate struct {
-	Min float64
-	Max float64
+	bounds
+	Rule string
+	Min  float64
+	Max  float64
 }
 
 func (r *rangeFloatValidate) Validate(param string, value interface{}) error {
 	v := reflect.ValueOf(value)
 	val := v.Float()
-	if val < r.Min || val > r.Max {
-		return &ValidationError{Param: param, Value: strconv.FormatFloat(val, 'e', 10, 64)}
+	if !inBounds(val, r.Min, r.Max, r.bounds) {
+		return &ValidationError{Param: param, Value: strconv.FormatFloat(val, 'e', 10, 64), Rule: r.Rule}
 	}
 	return nil
 }
 
 type lenValidate struct {
-	Min int
-	Max int
+	bounds
+	Rule string
+	Min  int
+	Max  int
+	Mode LengthMode
 }
 
 func (r *lenValidate) Validate(param string, value interface{}) error {
 	v := reflect.ValueOf(value)
 	val := v.String()
-	l := len(val)
+	var l int
+	switch r.Mode {
+	case RuneLength:
+		l = utf8.RuneCountInString(val)
+	case GraphemeLength:
+		l = graphemeCount(val)
+	default:
+		l = len(val)
+	}
+
+	if !inBounds(l, r.Min, r.Max, r.bounds) {
+		return &ValidationError{Param: param, Value: val, Rule: r.Rule}
+	}
+	return nil
+}
+
+// graphemeCount approximates the number of user perceived characters (extended grapheme
+// clusters) in s. Combining marks, variation selectors, emoji modifiers and tags extend the
+// previous character, characters joined by a zero width joiner count once, as do pairs of
+// regional indicators (flags), CR LF and Hangul jamo sequences.
+func graphemeCount(s string) int {
+	count := 0
+	var prev rune = -1
+	joined, regional := false, false
+	for _, r := range s {
+		switch {
+		case joined:
+			// the character after a zero width joiner is part of the same cluster.
+			joined = false
+		case r == '\u200d':
+			joined = true
+		case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc):
+		case r >= 0xfe00 && r <= 0xfe0f, r >= 0xe0100 && r <= 0xe01ef: // variation selectors
+		case r >= 0x1f3fb && r <= 0x1f3ff: // emoji modifiers
+		case r >= 0xe0020 && r <= 0xe007f: // tags
+		case r == '\n' && prev == '\r':
+		case r >= 0x1160 && r <= 0x11ff && prev >= 0x1100 && prev <= 0x11ff: // hangul jamo
+		case r >= 0x1f1e6 && r <= 0x1f1ff: // regional indicators pair up in to flags
+			if regional {
+				regional = false
+			} else {
+				regional = true
+				count++
+			}
+		default:
+			count++
+		}
+		if r < 0x1f1e6 || r > 0x1f1ff {
+			regional = false
+		}
+		prev = r
+	}
+	return count
+}
+
+type countValidate struct {
+	bounds
+	Rule string
+	Min  int
+	Max  int
+}
+
+func (r *countValidate) Validate(param string, value interface{}) error {
+	l := reflect.ValueOf(value).Len()
+
+	if !inBounds(l, r.Min, r.Max, r.bounds) {
+		return &ValidationError{Param: param, Value: strconv.Itoa(l), Rule: r.Rule}
+	}
+	return nil
+}
+
+// fieldGroup limits how many of its members may have a value, exactlyone(email|phone).
+type fieldGroup struct {
+	Rule    string   // the directive, exactlyone(email|phone).
+	Op      string   // exactlyone, atmostone or atleastone.
+	Members []string // the parameters of the members.
+	index   [][]int  // index of the field of each member, set when the fields are compiled.
+}
+
+// check returns a GroupError if count members having a value breaks the rule. params
+// are the parameters of the members as submitted, items[0].email.
+func (g *fieldGroup) check(params []string, count int) error {
+	ok := false
+	switch g.Op {
+	case "exactlyone":
+		ok = count == 1
+	case "atmostone":
+		ok = count <= 1
+	case "atleastone":
+		ok = count >= 1
+	}
+	if !ok {
+		return &GroupError{Members: params, Rule: g.Rule, Count: count}
+	}
+	return nil
+}
 
-	if l < r.Min || l > r.Max {
-		return &ValidationError{Param: param, Value: val}
+// condition decides if a field is required, or must not be submitted, from the values
+// of other fields, required_if(method=card).
+type condition struct {
+	Rule   string   // the directive, required_if(method=card).
+	Op     string   // required_if, required_with, required_without or excluded_if.
+	Params []string // the parameters the condition depends on.
+	Values []string // the values of the parameter which trigger required_if and excluded_if.
+	index  [][]int  // index of the field of each parameter, set when the fields are compiled.
+}
+
+// met returns true if the condition applies. present reports which of the condition's
+// parameters have a value and value is the value of the first.
+func (c *condition) met(present []bool, value string) bool {
+	switch c.Op {
+	case "required_with":
+		for _, p := range present {
+			if p {
+				return true
+			}
+		}
+	case "required_without":
+		for _, p := range present {
+			if !p {
+				return true
+			}
+		}
+	default:
+		if !present[0] {
+			return false
+		}
+		for _, v := range c.Values {
+			if v == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// check returns a RequiredParamError if the condition is met and the field has no value,
+// or an ExcludedParamError if an excluded_if condition is met and the field has a value.
+func (c *condition) check(f *field, met, has bool) error {
+	switch {
+	case !met:
+		return nil
+	case c.Op == "excluded_if" && has:
+		return &ExcludedParamError{Param: f.param, Field: f.name, Condition: c.Rule}
+	case c.Op != "excluded_if" && !has:
+		return &RequiredParamError{Param: f.param, Field: f.name, Condition: c.Rule}
+	}
+	return nil
+}
+
+// fieldCompare compares a field to a sibling field once every field has been assigned,
+// eqfield(Password) or gtfield(Start).
+type fieldCompare struct {
+	Rule  string // the directive, gtfield(Start).
+	Op    string // eqfield, nefield, gtfield, gtefield, ltfield or ltefield.
+	Field string // the Go name of the sibling field.
+	index []int  // index of the sibling field, set when the fields are compiled.
+}
+
+// compare returns a ValidationError if value does not compare to other as required.
+func (c *fieldCompare) compare(param string, value, other reflect.Value) error {
+	n := compareValues(value, other)
+
+	ok := false
+	switch c.Op {
+	case "eqfield":
+		ok = n == 0
+	case "nefield":
+		ok = n != 0
+	case "gtfield":
+		ok = n > 0
+	case "gtefield":
+		ok = n >= 0
+	case "ltfield":
+		ok = n < 0
+	case "ltefield":
+		ok = n <= 0
+	}
+	if !ok {
+		return &ValidationError{Param: param, Value: formatValue(value.Interface()), Rule: c.Rule}
 	}
 	return nil
 }
 
+// compareValues returns -1, 0 or 1 as a is less than, equal to or greater than b. Values
+// which aren't ordered return 0 if they are equal and 1 otherwise.
+func compareValues(a, b reflect.Value) int {
+	if a.Type() == timeType {
+		return a.Interface().(time.Time).Compare(b.Interface().(time.Time))
+	}
+
+	switch kindClass(a.Kind()) {
+	case reflect.Int64:
+		return cmp.Compare(a.Int(), b.Int())
+	case reflect.Uint64:
+		return cmp.Compare(a.Uint(), b.Uint())
+	case reflect.Float64:
+		return cmp.Compare(a.Float(), b.Float())
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	}
+	if a.Interface() == b.Interface() {
+		return 0
+	}
+	return 1
+}
+
 type regexValidate struct {
+	Rule      string
 	Pattern   *regexp.Regexp
 	MatchType int
 }
@@ -401,25 +1807,223 @@ func (r *regexValidate) Validate(param string, value interface{}) error {
 
 	if r.MatchType == regexMatch {
 		if matched := r.Pattern.MatchString(val); !matched {
-			return &ValidationError{Param: param, Value: val}
+			return &ValidationError{Param: param, Value: val, Rule: r.Rule}
 		}
 		// probably don't need regexFind
 	} else if r.MatchType == regexFind {
 		if found := r.Pattern.FindString(val); found == "" {
-			return &ValidationError{Param: param, Value: val}
+			return &ValidationError{Param: param, Value: val, Rule: r.Rule}
+		}
+	}
+
+	return nil
+}
+
+type oneOfValidate struct {
+	Rule    string
+	Allowed []string
+	Values  map[interface{}]bool // allowed values parsed to int64, uint64, float64 or string.
+	Fold    bool                 // compare strings case insensitively.
+}
+
+func (r *oneOfValidate) Validate(param string, value interface{}) error {
+	v := reflect.ValueOf(value)
+	var key interface{}
+	switch kindClass(v.Kind()) {
+	case reflect.Int64:
+		key = v.Int()
+	case reflect.Uint64:
+		key = v.Uint()
+	case reflect.Float64:
+		key = v.Float()
+	default:
+		key = v.String()
+		if r.Fold {
+			key = strings.ToLower(v.String())
 		}
 	}
 
+	if !r.Values[key] {
+		return &ValidationError{Param: param, Value: formatValue(value), Rule: r.Rule, Allowed: r.Allowed}
+	}
+	return nil
+}
+
+type timeBoundValidate struct {
+	Rule   string
+	Time   time.Time
+	Now    bool // compare against the time of validation instead of Time.
+	Before bool // the value must be before, otherwise after, the time.
+}
+
+func (r *timeBoundValidate) Validate(param string, value interface{}) error {
+	val := value.(time.Time)
+	bound := r.Time
+	if r.Now {
+		bound = time.Now()
+	}
+
+	if (r.Before && !val.Before(bound)) || (!r.Before && !val.After(bound)) {
+		return &ValidationError{Param: param, Value: val.Format(time.RFC3339), Rule: r.Rule}
+	}
+	return nil
+}
+
+type withinValidate struct {
+	Rule string
+	Min  time.Duration
+	Max  time.Duration
+}
+
+func (r *withinValidate) Validate(param string, value interface{}) error {
+	val := value.(time.Time)
+	now := time.Now()
+
+	if val.Before(now.Add(r.Min)) || val.After(now.Add(r.Max)) {
+		return &ValidationError{Param: param, Value: val.Format(time.RFC3339), Rule: r.Rule}
+	}
 	return nil
 }
 
-// for wrapping custom user functions.
+// for wrapping Validaters returned by custom functions so errors report the directive.
+type ruleValidate struct {
+	Rule      string
+	validater Validater
+}
+
+// validates the input with the wrapped Validater, errors other than a ValidationError
+// are wrapped in one.
+func (r *ruleValidate) Validate(param string, value interface{}) error {
+	err := r.validater.Validate(param, value)
+	if err == nil {
+		return nil
+	}
+	if verr, ok := err.(*ValidationError); ok {
+		return fillValidationError(verr, param, r.Rule)
+	}
+	return &ValidationError{Param: param, Value: formatValue(value), Rule: r.Rule, Err: err}
+}
+
+// fillValidationError returns a copy of a ValidationError returned by a custom Validater
+// with an empty Param or Rule filled in. The original is not modified as it may be shared.
+func fillValidationError(verr *ValidationError, param, rule string) *ValidationError {
+	filled := *verr
+	if filled.Param == "" {
+		filled.Param = param
+	}
+	if filled.Rule == "" {
+		filled.Rule = rule
+	}
+	return &filled
+}
+
+// for wrapping custom user functions. The function is resolved by name each time so
+// redefining it with Add takes effect immediately.
 type userValidate struct {
-	validateFn func(string) error
+	Name  string
+	Field string
+	fns   *validatorFunctions
 }
 
-// validates the input against a custom user function.
+// validates the input against a custom user function. Errors from functions added with
+// Add are kept in a funcError, other errors are wrapped in a ValidationError so the failing
+// Validater can be reported.
 func (u *userValidate) Validate(param string, value interface{}) error {
-	v := reflect.ValueOf(value)
-	return u.validateFn(v.String())
+	u.fns.RLock()
+	validateFn := u.fns.Funcs[u.Name]
+	validater := u.fns.Validaters[u.Name]
+	u.fns.RUnlock()
+
+	var err error
+	switch {
+	case validateFn != nil:
+		if err := validateFn(formatValue(value)); err != nil {
+			return &funcError{Param: param, Value: formatValue(value), Rule: u.Name, Err: err}
+		}
+		return nil
+	case validater != nil:
+		err = validater.Validate(param, value)
+	default:
+		return &UnknownDirectiveError{Field: u.Field, Directive: u.Name}
+	}
+
+	if err == nil {
+		return nil
+	}
+	if verr, ok := err.(*ValidationError); ok {
+		return fillValidationError(verr, param, u.Name)
+	}
+	return &ValidationError{Param: param, Value: formatValue(value), Rule: u.Name, Err: err}
+}
+
+// funcError holds the error returned by a function added with Add. Assign returns the
+// function's own error, AssignAll reports it as a ValidationError for the function.
+type funcError struct {
+	Param string
+	Value string
+	Rule  string
+	Err   error
+}
+
+func (e *funcError) Error() string {
+	return e.Err.Error()
+}
+
+// validationError returns the error reported by AssignAll.
+func (e *funcError) validationError() *ValidationError {
+	if verr, ok := e.Err.(*ValidationError); ok {
+		return fillValidationError(verr, e.Param, e.Rule)
+	}
+	return &ValidationError{Param: e.Param, Value: e.Value, Rule: e.Rule, Err: e.Err}
+}
+
+// unwrapFuncError returns the error a function added with Add returned, or err unchanged.
+func unwrapFuncError(err error) error {
+	if ferr, ok := err.(*funcError); ok {
+		return ferr.Err
+	}
+	return err
+}
+
+// typedValidate calls a function with the value converted to T.
+type typedValidate[T any] struct {
+	validateFn func(T) error
+}
+
+func (t *typedValidate[T]) ValueType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func (t *typedValidate[T]) Validate(param string, value interface{}) error {
+	val, ok := value.(T)
+	if !ok {
+		v := reflect.ValueOf(value)
+		if !v.IsValid() || !v.CanConvert(t.ValueType()) {
+			return &FuncTypeError{Func: "typed validator", Param: param, Type: fmt.Sprintf("%T", value)}
+		}
+		val = v.Convert(t.ValueType()).Interface().(T)
+	}
+	return t.validateFn(val)
+}
+
+// formatValue returns the string form of a parsed value, as passed to functions added with Add
+// and reported in ValidationError.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
 }
@@ -3,8 +3,12 @@ package validator
 import (
 	//"reflect"
 	"fmt"
+	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetArguments(t *testing.T) {
@@ -37,15 +41,403 @@ func TestAdd(t *testing.T) {
 	Add("badFn", badFn)
 	Add("okFn", okFn)
 
-	if err := userFns.Funcs["badFn"]("whatever"); err == nil {
+	if err := std.fns.Funcs["badFn"]("whatever"); err == nil {
 		t.Fatalf("error didn't occur.")
 	}
 
-	if err := userFns.Funcs["okFn"]("whatever"); err != nil {
+	if err := std.fns.Funcs["okFn"]("whatever"); err != nil {
 		t.Fatalf("error occurred: %v", err)
 	}
 }
 
+type LateForm struct {
+	Code string `validate:"code,late"`
+}
+
+func TestLateRegistration(t *testing.T) {
+	v := New()
+	params, _ := url.ParseQuery("code=abc")
+
+	if _, ok := v.Assign(params, &LateForm{}).(*UnknownDirectiveError); !ok {
+		t.Fatalf("error: late was used before it was added")
+	}
+
+	v.Add("late", testOkFn)
+	if err := v.Assign(params, &LateForm{}); err != nil {
+		t.Fatalf("error: late added after first use was not picked up: %v", err)
+	}
+
+	// redefining replaces the function for cached fields as well.
+	v.Add("late", testBadFn)
+	if err := v.Assign(params, &LateForm{}); err == nil {
+		t.Fatalf("error: redefined late function was not used")
+	}
+
+	v.Remove("late")
+	if _, ok := v.Assign(params, &LateForm{}).(*UnknownDirectiveError); !ok {
+		t.Fatalf("error: late was used after it was removed")
+	}
+
+	v.ClearCache()
+	if len(v.fieldCache.m) != 0 {
+		t.Fatalf("error: cache was not cleared")
+	}
+}
+
+type ShoutForm struct {
+	Name string `validate:"name,shout,default(d)"`
+}
+
+func TestClearCacheDuringCompile(t *testing.T) {
+	v := New()
+	// the default is transformed while the tag compiles, replace shout at that point.
+	v.RegisterTransform("shout", func(s string) string {
+		v.RegisterTransform("shout", strings.ToUpper)
+		return s + "!"
+	})
+	v.Assign(url.Values{}, &ShoutForm{})
+
+	st := &ShoutForm{}
+	if err := v.Assign(url.Values{"name": {"x"}}, st); err != nil || st.Name != "X" {
+		t.Fatalf("error: fields compiled before the cache was cleared were kept: %v %v", st.Name, err)
+	}
+}
+
+type divisibleValidate struct {
+	By int64
+}
+
+func (d *divisibleValidate) Validate(param string, value interface{}) error {
+	if value.(int64)%d.By != 0 {
+		return fmt.Errorf("%d is not divisible by %d", value, d.By)
+	}
+	return nil
+}
+
+func newDivisible(args []string) (Validater, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("divisible takes one argument")
+	}
+	n, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || n == 0 {
+		return nil, fmt.Errorf("invalid divisor %s", args[0])
+	}
+	return &divisibleValidate{By: n}, nil
+}
+
+type DivisibleForm struct {
+	Count int `validate:"count,divisible(3)"`
+}
+
+type BadDivisibleForm struct {
+	Count int `validate:"count,divisible(0)"`
+}
+
+func TestAddWithArgs(t *testing.T) {
+	v := New()
+	if err := v.AddWithArgs("range", newDivisible); err == nil {
+		t.Fatalf("error: built in name was allowed")
+	}
+	v.AddWithArgs("divisible", newDivisible)
+
+	params, _ := url.ParseQuery("count=9")
+	if err := v.Assign(params, &DivisibleForm{}); err != nil {
+		t.Fatalf("error: divisible value failed: %v", err)
+	}
+
+	params, _ = url.ParseQuery("count=10")
+	err := v.Assign(params, &DivisibleForm{})
+	verr, ok := err.(*ValidationError)
+	if !ok || verr.Rule != "divisible(3)" || verr.Err == nil {
+		t.Fatalf("error: expected divisible(3) to fail got: %v", err)
+	}
+
+	if _, ok := v.Assign(params, &BadDivisibleForm{}).(*FuncError); !ok {
+		t.Fatalf("error: bad divisible argument should be a FuncError")
+	}
+
+	// a shared error returned by a Validater is copied, not filled in.
+	v.AddWithArgs("divisible", func(args []string) (Validater, error) {
+		return &sentinelValidate{}, nil
+	})
+	err = v.Assign(params, &DivisibleForm{})
+	verr, ok = err.(*ValidationError)
+	if !ok || verr == errSentinel || verr.Param != "count" || verr.Rule != "divisible(3)" {
+		t.Fatalf("error: expected a filled in copy of the sentinel got: %v", err)
+	}
+	if errSentinel.Param != "" || errSentinel.Rule != "" {
+		t.Fatalf("error: sentinel error was modified: %v", errSentinel)
+	}
+}
+
+var errSentinel = &ValidationError{Value: "invalid"}
+
+type sentinelValidate struct{}
+
+func (s *sentinelValidate) Validate(param string, value interface{}) error {
+	return errSentinel
+}
+
+type positiveValidate struct{}
+
+func (p *positiveValidate) Validate(param string, value interface{}) error {
+	if f, ok := value.(float64); !ok || f <= 0 {
+		return fmt.Errorf("%v is not a positive float64", value)
+	}
+	return nil
+}
+
+type TypedForm struct {
+	Count  int       `validate:"count,even"`
+	Small  int8      `validate:"small,even"`
+	Price  float64   `validate:"price,positive"`
+	When   time.Time `validate:"when,weekday"`
+	Legacy uint      `validate:"legacy,legacy"`
+}
+
+type BadTypedForm struct {
+	Name string `validate:"name,even"`
+}
+
+type NarrowTypedForm struct {
+	N int64 `validate:"n,small"`
+}
+
+func TestTypedValidaters(t *testing.T) {
+	v := New()
+	v.AddValidater("even", Typed(func(n int) error {
+		if n%2 != 0 {
+			return fmt.Errorf("%d is odd", n)
+		}
+		return nil
+	}))
+	v.AddValidater("weekday", Typed(func(t time.Time) error {
+		if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+			return fmt.Errorf("weekend")
+		}
+		return nil
+	}))
+	// untyped validaters get the parsed value.
+	v.AddValidater("positive", &positiveValidate{})
+	v.Add("legacy", func(s string) error {
+		if s != "42" {
+			return fmt.Errorf("expected 42 got %s", s)
+		}
+		return nil
+	})
+
+	params, _ := url.ParseQuery("count=4&small=2&price=3&when=2014-01-28T00:00:00Z&legacy=42")
+	if err := v.Assign(params, &TypedForm{}); err != nil {
+		t.Fatalf("error: typed validaters failed valid input: %v", err)
+	}
+
+	params.Set("count", "3")
+	err := v.Assign(params, &TypedForm{})
+	if verr, ok := err.(*ValidationError); !ok || verr.Rule != "even" || verr.Value != "3" {
+		t.Fatalf("error: expected even to fail got: %v", err)
+	}
+	params.Set("count", "4")
+
+	params.Set("when", "2014-01-25T00:00:00Z")
+	if err := v.Assign(params, &TypedForm{}); err == nil {
+		t.Fatalf("error: weekday validater passed a saturday")
+	}
+
+	if _, ok := v.Assign(params, &BadTypedForm{}).(*FuncTypeError); !ok {
+		t.Fatalf("error: int validater on a string field should be a FuncTypeError")
+	}
+
+	// an int8 validater would see 300 as 44.
+	v.AddValidater("small", Typed(func(n int8) error {
+		if n > 100 {
+			return fmt.Errorf("%d is too big", n)
+		}
+		return nil
+	}))
+	if _, ok := v.Assign(url.Values{"n": {"300"}}, &NarrowTypedForm{}).(*FuncTypeError); !ok {
+		t.Fatalf("error: int8 validater on an int64 field should be a FuncTypeError")
+	}
+}
+
+func TestGetBounds(t *testing.T) {
+	min, max, b, err := getBounds("range(18:)", "range")
+	if err != nil || min != "18" || max != "" || b.NoMin || !b.NoMax {
+		t.Fatalf("error: open max not parsed: %s %s %v %v", min, max, b, err)
+	}
+
+	min, max, b, err = getBounds("range((0:1])", "range")
+	if err != nil || min != "0" || max != "1" || !b.MinExclusive || b.MaxExclusive {
+		t.Fatalf("error: exclusive min not parsed: %s %s %v %v", min, max, b, err)
+	}
+
+	min, max, b, err = getBounds("lt(100)", "lt")
+	if err != nil || max != "100" || !b.NoMin || !b.MaxExclusive {
+		t.Fatalf("error: lt not parsed: %s %s %v %v", min, max, b, err)
+	}
+
+	for _, bad := range []string{"range(:)", "range(1:2:3)", "gt()", "gte(1:2)"} {
+		if _, _, _, err := getBounds(bad, directiveName(bad)); err == nil {
+			t.Fatalf("error: %s parsed", bad)
+		}
+	}
+}
+
+type BoundsForm struct {
+	Age     int     `validate:"age,optional,range(18:)"`
+	Score   uint    `validate:"score,optional,range(:100)"`
+	Ratio   float64 `validate:"ratio,optional,range((0:1])"`
+	Price   float64 `validate:"price,optional,gt(0)"`
+	Percent int     `validate:"percent,optional,lte(100),gte(0)"`
+	Temp    int     `validate:"temp,optional,lt(100)"`
+	Bio     string  `validate:"bio,optional,len(:5)"`
+}
+
+type EmptyBoundsForm struct {
+	Ratio float64 `validate:"ratio,range((1:1])"`
+}
+
+func TestOpenBounds(t *testing.T) {
+	good, _ := url.ParseQuery("age=99&score=0&ratio=1&price=0.01&percent=100&temp=99&bio=abcde")
+	if err := Assign(good, &BoundsForm{}); err != nil {
+		t.Fatalf("error: values within bounds failed: %v", err)
+	}
+
+	bad := map[string]string{"age": "17", "score": "101", "ratio": "0", "price": "0", "percent": "101", "temp": "100", "bio": "abcdef"}
+	for param, value := range bad {
+		params := url.Values{}
+		params.Set(param, value)
+		if _, ok := Assign(params, &BoundsForm{}).(*ValidationError); !ok {
+			t.Fatalf("error: %s=%s passed validation", param, value)
+		}
+	}
+
+	params, _ := url.ParseQuery("ratio=1")
+	if _, ok := Assign(params, &EmptyBoundsForm{}).(*FuncError); !ok {
+		t.Fatalf("error: empty range was not a FuncError")
+	}
+}
+
+func TestGraphemeCount(t *testing.T) {
+	tests := map[string]int{
+		"abc":                3,
+		"山田太郎":               4,
+		"e\u0301":            1, // e + combining acute
+		"👍🏽":                 1, // thumbs up + skin tone
+		"👩\u200d💻":           1, // woman technologist
+		"🇯🇵🇺🇸":               2, // two flags
+		"\r\n":               1,
+		"\u1100\u1161\u11a8": 1, // hangul jamo
+		"":                   0,
+	}
+	for s, want := range tests {
+		if got := graphemeCount(s); got != want {
+			t.Fatalf("error: graphemeCount(%q) = %d want %d", s, got, want)
+		}
+	}
+}
+
+type NameLenForm struct {
+	Name  string `validate:"name,len(1:5)"`
+	Runes string `validate:"runes,optional,runelen(1:5)"`
+	Bytes string `validate:"bytes,optional,bytelen(1:5)"`
+	Chars string `validate:"chars,optional,graphemelen(1:2)"`
+}
+
+func TestLengthModes(t *testing.T) {
+	params := url.Values{}
+	params.Set("name", "山田太郎")
+	if err := Assign(params, &NameLenForm{}); err == nil {
+		t.Fatalf("error: default len counted runes instead of bytes")
+	}
+
+	v := New(Length(RuneLength))
+	if err := v.Assign(params, &NameLenForm{}); err != nil {
+		t.Fatalf("error: rune length validator counted bytes: %v", err)
+	}
+
+	params.Set("runes", "山田太郎")
+	params.Set("chars", "👩\u200d💻e\u0301")
+	if err := Assign(params, &NameLenForm{}); err == nil {
+		t.Fatalf("error: default len should still fail on name")
+	}
+	params.Set("name", "abc")
+	if err := Assign(params, &NameLenForm{}); err != nil {
+		t.Fatalf("error: runelen or graphemelen failed: %v", err)
+	}
+
+	// bytelen always counts bytes.
+	params.Set("bytes", "山田")
+	if err := v.Assign(params, &NameLenForm{}); err == nil {
+		t.Fatalf("error: bytelen counted runes")
+	}
+}
+
+type TransformForm struct {
+	Email string   `validate:"email,trim,lower,len(3:50)"`
+	Code  string   `validate:"code,upper,oneof(ABC|DEF)"`
+	Title string   `validate:"title,collapse,len(1:20)"`
+	Phone string   `validate:"phone,optional,digits,len(10:10)"`
+	Tags  []string `validate:"tags,optional,split(,),lower,trim"`
+}
+
+type BadTransformForm struct {
+	Name string `validate:"name,trim(x)"`
+}
+
+func TestTransforms(t *testing.T) {
+	v := New()
+	err := v.RegisterTransform("digits", func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r < '0' || r > '9' {
+				return -1
+			}
+			return r
+		}, s)
+	})
+	if err != nil {
+		t.Fatalf("error: registering transform failed: %v", err)
+	}
+	if err := v.RegisterTransform("lower", strings.ToLower); err == nil {
+		t.Fatalf("error: transform allowed to replace a built in")
+	}
+
+	params := url.Values{}
+	params.Set("email", "  John@Example.COM ")
+	params.Set("code", "abc")
+	params.Set("title", "  a   long\t title ")
+	params.Set("phone", "(555) 123-4567")
+	params.Set("tags", " Go, WEB ,")
+	st := &TransformForm{}
+	if err := v.Assign(params, st); err != nil {
+		t.Fatalf("error: transformed values failed: %v", err)
+	}
+	if st.Email != "john@example.com" || st.Code != "ABC" || st.Title != "a long title" || st.Phone != "5551234567" {
+		t.Fatalf("error: values not transformed: %#v", st)
+	}
+	if strings.Join(st.Tags, "|") != "go|web" {
+		t.Fatalf("error: split values not transformed: %v", st.Tags)
+	}
+
+	// the default Validator doesn't know digits.
+	if _, ok := Assign(params, &TransformForm{}).(*UnknownDirectiveError); !ok {
+		t.Fatalf("error: transform registered on another Validator was found")
+	}
+
+	// built in transforms don't take arguments.
+	errs, ok := Precompile(&BadTransformForm{}).(CompileErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("error: transform with arguments compiled")
+	}
+	if _, ok := errs[0].Err.(*FuncError); !ok {
+		t.Fatalf("error: transform with arguments should be a FuncError got %v", errs[0].Err)
+	}
+
+	v.Remove("digits")
+	if _, ok := v.Assign(params, &TransformForm{}).(*UnknownDirectiveError); !ok {
+		t.Fatalf("error: removed transform still used")
+	}
+}
+
 func TestIntFuncArguments(t *testing.T) {
 	nmin, nmax, err := intFuncArguments("-1", "2", "range")
 	if err != nil {
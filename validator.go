@@ -25,8 +25,11 @@ THE SOFTWARE.
 // This library is for automatically assigning HTTP form values, a map[string][]string or
 // a map[string]string to a pre-defined structure. It also allows you to validate the data
 // prior to allowing assignment to occur. If any field is found to fail validation, an
-// error is immediately returned and further processing is stopped. Additionally, you may
-// supply your own functions by calling Add. For more information and examples see:
+// error is immediately returned and further processing is stopped. If you would rather
+// get every failing parameter back at once, use AssignAll or AssignSingleAll which return
+// a ValidationErrors. Additionally, you may supply your own functions by calling Add.
+// The package level functions share a default Validator, call New to get a Validator
+// with its own custom functions and field cache. For more information and examples see:
 //
 // https://github.com/wirepair/validator/
 package validator
@@ -34,8 +37,11 @@ package validator
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type TypeError struct {
@@ -50,166 +56,1423 @@ func (e *TypeError) Error() string {
 }
 
 type RequiredParamError struct {
-	Param string // the parameter that is required
-	Field string // the field name
+	Param     string // the parameter that is required
+	Field     string // the field name
+	Condition string // the directive which made the parameter required, if any, required_if(method=card)
 }
 
 // Returned when validator is unable to find a required parameter.
 func (r *RequiredParamError) Error() string {
-	return "validate: error the required parameter " + r.Param + " is missing from the input for assignment to " + r.Field
+	msg := "validate: error the required parameter " + r.Param + " is missing from the input for assignment to " + r.Field
+	if r.Condition != "" {
+		msg += " (" + r.Condition + ")"
+	}
+	return msg
+}
+
+type ExcludedParamError struct {
+	Param     string // the parameter that must not be submitted
+	Field     string // the field name
+	Condition string // the directive which excluded the parameter, excluded_if(method=cash)
+}
+
+// Returned when a parameter is submitted but an excluded_if condition says it must not be.
+func (e *ExcludedParamError) Error() string {
+	return "validate: error the parameter " + e.Param + " for assignment to " + e.Field + " must not be set (" + e.Condition + ")"
+}
+
+type CantSetError struct {
+	Param string       // the parameter that is being attempted to be set
+	Type  reflect.Type // the type of the field.
+}
+
+// Returned when validator is unable to set the type
+func (c *CantSetError) Error() string {
+	return "validate: error attempting to set " + c.Param + " with the Go value of type " + c.Type.String()
+}
+
+type UnknownParamError struct {
+	Params []string // the parameters which do not map to a field, sorted.
+}
+
+// Returned by a strict Validator when the input contains parameters which are not assigned to any field.
+func (u *UnknownParamError) Error() string {
+	return "validate: error unknown parameters " + strings.Join(u.Params, ", ") + " in the input"
+}
+
+type IndexError struct {
+	Param string // the indexed parameter, items[5000].name
+	Index int    // the index which was too large
+	Max   int    // the largest index allowed
+}
+
+// Returned when the index of a parameter for a slice of structures is larger than the Validator's MaxIndex.
+func (e *IndexError) Error() string {
+	return "validate: error index " + strconv.Itoa(e.Index) + " of parameter " + e.Param + " is larger than the maximum of " + strconv.Itoa(e.Max)
+}
+
+type CompileError struct {
+	Type reflect.Type // the structure type
+	Err  error        // the error for the field, TagError, UnknownDirectiveError, FuncError etc.
+}
+
+// Returned as an element of CompileErrors for each field of a structure which failed to compile.
+func (c *CompileError) Error() string {
+	// Precompile(nil) has no type to report.
+	if c.Type == nil {
+		return c.Err.Error()
+	}
+	return c.Type.String() + ": " + c.Err.Error()
+}
+
+// Unwrap returns the error for the field.
+func (c *CompileError) Unwrap() error {
+	return c.Err
+}
+
+type CompileErrors []*CompileError
+
+// Returned by Precompile listing every field which failed to compile.
+func (c CompileErrors) Error() string {
+	msgs := make([]string, len(c))
+	for i, err := range c {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns each CompileError so errors.Is and errors.As check every element.
+func (c CompileErrors) Unwrap() []error {
+	errs := make([]error, len(c))
+	for i, err := range c {
+		errs[i] = err
+	}
+	return errs
+}
+
+type ParamError struct {
+	Param string // the parameter name from the supplied map/form data
+	Field string // the field name
+	Rule  string // the rule that failed: required, type or the validate directive
+	Value string // the value that caused the error
+	Err   error  // the underlying error
+}
+
+// Returned as an element of ValidationErrors for each parameter that failed.
+func (p *ParamError) Error() string {
+	return p.Err.Error()
+}
+
+// Unwrap returns the underlying error so errors.As can reach TypeError, RequiredParamError etc.
+func (p *ParamError) Unwrap() error {
+	return p.Err
+}
+
+type ValidationErrors []*ParamError
+
+// Returned by AssignAll and AssignSingleAll listing every parameter that failed.
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, len(v))
+	for i, err := range v {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns each ParamError so errors.Is and errors.As check every element.
+func (v ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(v))
+	for i, err := range v {
+		errs[i] = err
+	}
+	return errs
+}
+
+type field struct {
+	name       string
+	param      string
+	tags       string
+	typ        reflect.Type
+	optional   bool
+	index      []int // index sequence for FieldByIndex, nested struct fields have more than one.
+	validators []Validater
+	counts     []Validater           // count, minitems and maxitems validators, passed the whole slice.
+	unique     bool                  // slice elements may not repeat.
+	partial    bool                  // arrays may be submitted fewer values than their length.
+	split      string                // separator to split each value of a slice field on.
+	transforms []func(string) string // run in tag order on each value before it is parsed.
+	elems      []field               // fields of each element of a slice of structures, nil otherwise.
+	keys       []Validater           // validators for the keys of a map field.
+	defaults   []string              // values assigned when the parameter is missing or empty.
+	compares   []fieldCompare        // comparisons to sibling fields, eqfield(Password).
+	conditions []condition           // conditional presence rules, required_if(method=card).
+	groups     []fieldGroup          // groups declared by a blank field, exactlyone(email|phone).
+	maxIndex   int                   // the largest element index accepted for a slice of structures.
+	within     []optionalStruct      // the optional nested structures the field belongs to.
+
+	convert     func(string) (interface{}, error) // converter or TextUnmarshaler for the field type, if any.
+	convertType reflect.Type                      // the type convert returns values for.
+}
+
+// optionalStruct is a nested structure marked optional, its fields are skipped when no
+// parameter starts with prefix (address.) or, when validating, the structure is zero.
+type optionalStruct struct {
+	prefix string
+	index  []int
+}
+
+type cache struct {
+	sync.RWMutex
+	m          map[reflect.Type][]field
+	generation uint64 // incremented by ClearCache so compiles started before it aren't stored.
+}
+
+// current returns the generation of the cache, read before compiling fields to store.
+func (c *cache) current() uint64 {
+	c.RLock()
+	defer c.RUnlock()
+	return c.generation
+}
+
+// store caches the fields for key unless the cache was cleared since generation was read,
+// they may have been compiled with functions which have since been replaced.
+func (c *cache) store(key reflect.Type, fields []field, generation uint64) {
+	c.Lock()
+	if c.generation == generation {
+		c.m[key] = fields
+	}
+	c.Unlock()
+}
+
+// Validator assigns and validates input using its own custom functions and field cache,
+// so registrations made on one Validator are not seen by any other. The package level
+// functions such as Assign and Add use a default Validator.
+type Validator struct {
+	fns        *validatorFunctions // custom user functions added with Add.
+	converters *typeConverters     // converters added with RegisterConverter.
+	fieldCache cache               // for caching field look ups.
+	strict     bool                // reject parameters which are not assigned to a field.
+	allowed    map[string]bool     // parameters a strict Validator ignores.
+	lengthMode LengthMode          // how the len directive measures strings.
+	maxIndex   int                 // the largest index accepted for slices of structures.
+}
+
+// An Option configures a Validator created with New.
+type Option func(*Validator)
+
+// LengthMode selects how string lengths are measured by the len directive.
+type LengthMode int
+
+const (
+	ByteLength     LengthMode = iota // count bytes, the default and the same as bytelen.
+	RuneLength                       // count unicode code points, the same as runelen.
+	GraphemeLength                   // count user perceived characters, the same as graphemelen.
+)
+
+// Length sets how the len directive measures strings for the Validator. The bytelen,
+// runelen and graphemelen directives always use their own measurement.
+func Length(mode LengthMode) Option {
+	return func(vd *Validator) {
+		vd.lengthMode = mode
+	}
+}
+
+// DefaultMaxIndex is the largest index of a slice of structures accepted unless MaxIndex is used.
+const DefaultMaxIndex = 1000
+
+// MaxIndex sets the largest index accepted in parameters for slices of structures, such
+// as items[10][name]. Slices are allocated up to the largest index submitted, so this
+// bounds how much memory a single request can make the Validator allocate.
+func MaxIndex(max int) Option {
+	return func(vd *Validator) {
+		vd.maxIndex = max
+	}
+}
+
+// Strict makes the Validator return an UnknownParamError, before anything is assigned, if
+// the input contains parameters which do not map to a tagged field. Parameters which are
+// expected but not assigned, such as a csrf_token, may be listed in allowed.
+func Strict(allowed ...string) Option {
+	return func(vd *Validator) {
+		vd.strict = true
+		vd.allowed = make(map[string]bool, len(allowed))
+		for _, param := range allowed {
+			vd.allowed[param] = true
+		}
+	}
+}
+
+// New returns a Validator with an empty function registry and field cache.
+func New(opts ...Option) *Validator {
+	vd := &Validator{fns: &validatorFunctions{}, converters: &typeConverters{}, maxIndex: DefaultMaxIndex}
+	vd.fieldCache.m = make(map[reflect.Type][]field, 1)
+	for _, opt := range opts {
+		opt(vd)
+	}
+	return vd
+}
+
+var std = New() // the Validator used by the package level functions.
+
+// Assign iterates over input map keys and assigns the value to the passed in structure (v),
+// alternatively validating the input.
+func Assign(params map[string][]string, v interface{}) error {
+	return std.Assign(params, v)
+}
+
+// AssignSingle iterates over input map keys with single string values and assigns it to the
+// passed in structure (v), alternatively validating the input.
+func AssignSingle(params map[string]string, v interface{}) error {
+	return std.AssignSingle(params, v)
+}
+
+// AssignAll is the same as Assign except it does not stop at the first failing parameter.
+// Every field is processed and a ValidationErrors is returned containing each failure.
+func AssignAll(params map[string][]string, v interface{}) error {
+	return std.AssignAll(params, v)
+}
+
+// AssignSingleAll is the same as AssignSingle except it does not stop at the first failing
+// parameter. Every field is processed and a ValidationErrors is returned containing each failure.
+func AssignSingleAll(params map[string]string, v interface{}) error {
+	return std.AssignSingleAll(params, v)
+}
+
+// Assign iterates over input map keys and assigns the value to the passed in structure (v),
+// alternatively validating the input.
+func (vd *Validator) Assign(params map[string][]string, v interface{}) error {
+	fields, err := vd.getFields(v)
+	if err != nil {
+		return err
+	}
+
+	return vd.assign(params, fields, v, false)
+}
+
+// AssignSingle iterates over input map keys with single string values and assigns it to the
+// passed in structure (v), alternatively validating the input.
+func (vd *Validator) AssignSingle(params map[string]string, v interface{}) error {
+	fields, err := vd.getFields(v)
+	if err != nil {
+		return err
+	}
+	return vd.assign(singleParams(params), fields, v, false)
+}
+
+// AssignAll is the same as Assign except it does not stop at the first failing parameter.
+// Every field is processed and a ValidationErrors is returned containing each failure.
+func (vd *Validator) AssignAll(params map[string][]string, v interface{}) error {
+	fields, err := vd.getFields(v)
+	if err != nil {
+		return err
+	}
+	return vd.assign(params, fields, v, true)
+}
+
+// AssignSingleAll is the same as AssignSingle except it does not stop at the first failing
+// parameter. Every field is processed and a ValidationErrors is returned containing each failure.
+func (vd *Validator) AssignSingleAll(params map[string]string, v interface{}) error {
+	fields, err := vd.getFields(v)
+	if err != nil {
+		return err
+	}
+	return vd.assign(singleParams(params), fields, v, true)
+}
+
+// Validate runs the validate and regex tag validators of the default Validator against
+// the current values of the passed in structure (v) without assigning anything.
+func Validate(v interface{}) error {
+	return std.Validate(v)
+}
+
+// Validate runs the validators of each tagged field of the passed in structure (v), or
+// pointer to structure, against its current value. Fields are not modified. Fields which
+// are not optional and still hold their zero value return a RequiredParamError.
+func (vd *Validator) Validate(v interface{}) error {
+	st := reflect.ValueOf(v)
+	if st.Kind() == reflect.Ptr && !st.IsNil() {
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: error %v is not a structure", reflect.TypeOf(v))
+	}
+	if !st.CanAddr() {
+		// fields are checked to be settable the same as when assigning, so use a copy.
+		copied := reflect.New(st.Type())
+		copied.Elem().Set(st)
+		st = copied.Elem()
+	}
+
+	fields, err := vd.getFields(st.Addr().Interface())
+	if err != nil {
+		return err
+	}
+	return unwrapFuncError(validateFields(fields, st))
+}
+
+// iterates over each field of the structure and assigns various directives on how to
+// parse, validate and process the value to be assigned to that field.
+// for performance reasons we also store field lookups in a synchronized cache so
+// if we get the same struct many times we only have to analyze the structtags a single
+// time.
+func (vd *Validator) getFields(v interface{}) ([]field, error) {
+	cacheKey := reflect.TypeOf(v)
+
+	vd.fieldCache.RLock()
+	f := vd.fieldCache.m[cacheKey]
+	generation := vd.fieldCache.generation
+	vd.fieldCache.RUnlock()
+	if f != nil {
+		return f, nil
+	}
+
+	fields, errs := vd.compileFields(cacheKey.Elem(), "", nil, make(map[reflect.Type]bool))
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	vd.fieldCache.store(cacheKey, fields, generation)
+	return fields, nil
+}
+
+// Precompile parses the tags of each structure passed in using the default Validator.
+// See Validator.Precompile.
+func Precompile(types ...interface{}) error {
+	return std.Precompile(types...)
+}
+
+// MustPrecompile is like Precompile but panics if any tag fails to compile.
+func MustPrecompile(types ...interface{}) {
+	std.MustPrecompile(types...)
+}
+
+// Precompile parses the tags of each structure (or pointer to structure) passed in and
+// stores the result in the field cache. Call this at start up to find mistakes in struct
+// tags before any input is processed. Every field of every type is checked, all of the
+// failures are returned as CompileErrors.
+func (vd *Validator) Precompile(types ...interface{}) error {
+	var errs CompileErrors
+	for _, v := range types {
+		cacheKey := reflect.TypeOf(v)
+		if cacheKey != nil && cacheKey.Kind() != reflect.Ptr {
+			cacheKey = reflect.PtrTo(cacheKey)
+		}
+		if cacheKey == nil || cacheKey.Elem().Kind() != reflect.Struct {
+			err := fmt.Errorf("validate: error %v is not a structure", cacheKey)
+			errs = append(errs, &CompileError{Type: cacheKey, Err: err})
+			continue
+		}
+
+		generation := vd.fieldCache.current()
+		fields, fieldErrs := vd.compileFields(cacheKey.Elem(), "", nil, make(map[reflect.Type]bool))
+		for _, err := range fieldErrs {
+			errs = append(errs, &CompileError{Type: cacheKey.Elem(), Err: err})
+		}
+		if len(fieldErrs) == 0 {
+			vd.fieldCache.store(cacheKey, fields, generation)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// MustPrecompile is like Precompile but panics if any tag fails to compile.
+func (vd *Validator) MustPrecompile(types ...interface{}) {
+	if err := vd.Precompile(types...); err != nil {
+		panic(err)
+	}
+}
+
+// compileFields parses the tags of each field of the structure type st. Fields which are
+// themselves structures are recursed in to, their fields are flattened in to the returned
+// slice with the parent parameter name and a dot prefixed to their own (address.city).
+// Slices of structures keep the fields of their element type in elems. compiling holds
+// the types being compiled so recursive slices of structures can be rejected.
+// A field which fails to compile does not stop the remaining fields from being checked,
+// every error is returned.
+func (vd *Validator) compileFields(st reflect.Type, prefix string, index []int, compiling map[reflect.Type]bool) ([]field, []error) {
+	fields := make([]field, 0, st.NumField())
+	var errs []error
+
+	compiling[st] = true
+	defer delete(compiling, st)
+
+	for i := 0; i < st.NumField(); i++ {
+		f := &field{}
+		f.typ = st.Field(i).Type
+		f.name = st.Field(i).Name
+		f.index = append(append(make([]int, 0, len(index)+1), index...), i)
+		f.convertType, f.convert = vd.converter(f.typ)
+
+		// sets param,optional flags and validators.
+		if err := vd.setDirectives(st.Field(i).Tag, f); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if f.param != "" && f.convert == nil && isNested(f.typ) {
+			if err := checkNested(st.Field(i).Tag, f); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			children, childErrs := vd.compileFields(f.typ, prefix+f.param+".", f.index, compiling)
+			errs = append(errs, childErrs...)
+			for j := range children {
+				children[j].name = f.name + "." + children[j].name
+				if f.optional {
+					children[j].within = append(children[j].within, optionalStruct{prefix: prefix + f.param + ".", index: f.index})
+				}
+			}
+			fields = append(fields, children...)
+			continue
+		}
+
+		if f.param != "" && f.convert == nil && f.typ.Kind() == reflect.Slice && isNested(elemType(f.typ)) {
+			if err := vd.compileElems(f, compiling); err != nil {
+				errs = append(errs, err...)
+				continue
+			}
+		}
+
+		// only slices of structures are assigned element by element, an array would never be set.
+		if f.param != "" && f.convert == nil && f.typ.Kind() == reflect.Array && isNested(elemType(f.typ)) {
+			errs = append(errs, &FuncTypeError{Func: "assign", Param: f.param, Type: f.typ.String()})
+			continue
+		}
+
+		if f.param != "" && f.typ.Kind() == reflect.Map && !isEntries(f) {
+			errs = append(errs, fmt.Errorf("validate: error %v is not a supported map type for parameter %s.", f.typ, f.param))
+			continue
+		}
+
+		if f.param != "" {
+			f.param = prefix + f.param
+		}
+		fields = append(fields, *f)
+	}
+	errs = append(errs, resolveCompares(fields, len(index)+1)...)
+	errs = append(errs, resolveConditions(fields, len(index)+1, prefix)...)
+	errs = append(errs, resolveGroups(fields, len(index)+1, prefix)...)
+	return fields, errs
+}
+
+// checkNested returns an error for a nested structure field with directives other than
+// optional, as its fields are assigned individually there is nothing to apply them to.
+func checkNested(t reflect.StructTag, f *field) error {
+	for _, directive := range splitDirectives(t.Get("validate"))[1:] {
+		if directive != "optional" {
+			return fmt.Errorf("validate: error directive %s is not supported for structure field %s", directive, f.name)
+		}
+	}
+	if t.Get("regex") != "" {
+		return &TagError{Tag: "regex", Field: f.name}
+	}
+	return nil
+}
+
+// compileElems compiles the fields of the element type of a slice of structures field.
+// The element fields have parameters relative to the element, qty rather than items[0].qty.
+func (vd *Validator) compileElems(f *field, compiling map[reflect.Type]bool) []error {
+	elem := elemType(f.typ)
+	if compiling[elem] {
+		return []error{fmt.Errorf("validate: error %v is a recursive type for field %s", elem, f.name)}
+	}
+	if f.unique || f.split != "" {
+		return []error{&FuncTypeError{Func: "unique/split", Param: f.param, Type: elem.Kind().String()}}
+	}
+
+	elems, errs := vd.compileFields(elem, "", nil, compiling)
+	if len(errs) > 0 {
+		return errs
+	}
+	f.elems = elems
+	f.maxIndex = vd.maxIndex
+	return nil
+}
+
+// isEntries returns true if the map field has string keys and values which can be
+// assigned from a parameter, scalars or slices of scalars.
+func isEntries(f *field) bool {
+	if f.typ.Key().Kind() != reflect.String {
+		return false
+	}
+	value := f.typ.Elem()
+	if value.Kind() == reflect.Map || value.Kind() == reflect.Slice && value.Elem().Kind() == reflect.Slice {
+		return false
+	}
+	return f.convert != nil || !isNested(elemType(f.typ))
+}
+
+// isNested returns true if the type is a structure whose fields should be assigned individually.
+// Structures with a converter are assigned as a single value instead.
+func isNested(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Struct
+}
+
+// normalizeParams rewrites bracket notation parameters in to the form used for field
+// parameters, items[0][name] becomes items[0].name and tags[] becomes tags. The params
+// map is returned unchanged if no parameter uses brackets.
+func normalizeParams(params map[string][]string) map[string][]string {
+	brackets := false
+	for param := range params {
+		if strings.Contains(param, "[") {
+			brackets = true
+			break
+		}
+	}
+	if !brackets {
+		return params
+	}
+
+	// parameters which normalize to the same name are merged in sorted order, so tags
+	// comes before tags[] and the order of the values is the same for every request.
+	names := make([]string, 0, len(params))
+	for param := range params {
+		names = append(names, param)
+	}
+	sort.Strings(names)
+
+	normalized := make(map[string][]string, len(params))
+	for _, param := range names {
+		key := normalizeParam(param)
+		normalized[key] = append(normalized[key], params[param]...)
+	}
+	return normalized
+}
+
+// normalizeParam rewrites a single parameter name, numeric indexes are kept in brackets,
+// names in brackets become dotted and empty brackets are removed.
+func normalizeParam(param string) string {
+	open := strings.Index(param, "[")
+	if open <= 0 {
+		return param
+	}
+
+	normalized := make([]byte, 0, len(param))
+	for open != -1 {
+		end := strings.Index(param[open:], "]")
+		if end == -1 {
+			break
+		}
+		normalized = append(normalized, param[:open]...)
+
+		segment := param[open+1 : open+end]
+		if segment != "" && strings.Trim(segment, "0123456789") == "" {
+			normalized = append(normalized, "["+segment+"]"...)
+		} else if segment != "" {
+			normalized = append(normalized, "."+segment...)
+		}
+		param = param[open+end+1:]
+		open = strings.Index(param, "[")
+	}
+	return string(append(normalized, param...))
+}
+
+// elemParam splits an indexed parameter of the slice parameter prefix in to the index and
+// the parameter of the element, items[1].qty returns 1 and qty. Indexes with leading
+// zeros are not accepted so each element has a single parameter name.
+func elemParam(prefix, param string) (int, string, bool) {
+	if !strings.HasPrefix(param, prefix+"[") {
+		return 0, "", false
+	}
+	rest := param[len(prefix)+1:]
+	end := strings.Index(rest, "]")
+	if end <= 0 || !strings.HasPrefix(rest[end+1:], ".") {
+		return 0, "", false
+	}
+
+	index, err := strconv.Atoi(rest[:end])
+	if err != nil || index < 0 || strconv.Itoa(index) != rest[:end] {
+		return 0, "", false
+	}
+	return index, rest[end+2:], true
+}
+
+// elemFields returns copies of the element fields of f with the index of element i
+// added to their parameters and names, items[1].qty and Items[1].Qty.
+func elemFields(f *field, i int) []field {
+	children := make([]field, len(f.elems))
+	copy(children, f.elems)
+
+	idx := "[" + strconv.Itoa(i) + "]."
+	for j := range children {
+		if children[j].param != "" {
+			children[j].param = f.param + idx + children[j].param
+		}
+		children[j].name = f.name + idx + children[j].name
+		if children[j].within != nil {
+			within := make([]optionalStruct, len(children[j].within))
+			for k, o := range children[j].within {
+				within[k] = optionalStruct{prefix: f.param + idx + o.prefix, index: o.index}
+			}
+			children[j].within = within
+		}
+	}
+	return children
+}
+
+// omitted returns true if the field belongs to an optional nested structure which has no
+// parameters.
+func omitted(params map[string][]string, f *field) bool {
+	for _, o := range f.within {
+		submitted := false
+		for param := range params {
+			if strings.HasPrefix(param, o.prefix) {
+				submitted = true
+				break
+			}
+		}
+		if !submitted {
+			return true
+		}
+	}
+	return false
+}
+
+// mapKey returns the key of a parameter for the map parameter prefix, meta.color and
+// meta[7] return color and 7.
+func mapKey(prefix, param string) (string, bool) {
+	if !strings.HasPrefix(param, prefix) || len(param) <= len(prefix)+1 {
+		return "", false
+	}
+
+	rest := param[len(prefix):]
+	switch {
+	case rest[0] == '.':
+		return rest[1:], true
+	case rest[0] == '[' && strings.Index(rest, "]") == len(rest)-1 && len(rest) > 2:
+		return rest[1 : len(rest)-1], true
+	}
+	return "", false
+}
+
+// entryField returns a copy of the map field f for the entry key, meta[color]. The count
+// validators of the field apply to the map and not to the value of each entry.
+func entryField(f *field, key string) field {
+	entry := *f
+	entry.param = f.param + "[" + key + "]"
+	entry.name = f.name + "[" + key + "]"
+	entry.counts = nil
+	return entry
+}
+
+// singleParams converts single string values in to the map[string][]string form used by assign.
+// Empty values are kept so required parameters set to "" are still reported.
+func singleParams(params map[string]string) map[string][]string {
+	multi := make(map[string][]string, len(params))
+	for k, v := range params {
+		multi[k] = []string{v}
+	}
+	return multi
+}
+
+// assign checks for unknown parameters if the Validator is strict before assigning.
+func (vd *Validator) assign(params map[string][]string, fields []field, v interface{}, collect bool) error {
+	if vd.strict {
+		if unknown := vd.unknownParams(params, fields); len(unknown) > 0 {
+			return &UnknownParamError{Params: unknown}
+		}
+	}
+	return assign(normalizeParams(params), fields, v, collect)
+}
+
+// unknownParams returns the sorted parameters which are not allowed and do not map to a field.
+// Parameters are reported as they were sent, items[0][bogus] rather than items[0].bogus.
+func (vd *Validator) unknownParams(params map[string][]string, fields []field) []string {
+	unknown := make([]string, 0)
+	for param := range params {
+		normalized := normalizeParam(param)
+		if !vd.allowed[param] && !vd.allowed[normalized] && !knownParam(fields, normalized) {
+			unknown = append(unknown, param)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// knownParam returns true if the parameter maps to one of the fields, or to a field of an
+// element of a slice of structures.
+func knownParam(fields []field, param string) bool {
+	for i := range fields {
+		f := &fields[i]
+		if f.param == "" {
+			continue
+		}
+		switch {
+		case f.elems != nil:
+			if _, rest, ok := elemParam(f.param, param); ok && knownParam(f.elems, rest) {
+				return true
+			}
+		case f.typ.Kind() == reflect.Map:
+			if _, ok := mapKey(f.param, param); ok {
+				return true
+			}
+		case f.param == param:
+			return true
+		}
+	}
+	return false
+}
+
+// assign validates fields are settable, parameters aren't empty and that fields set
+// as optional are validated (unless empty, then disregarded). If collect is true every
+// field is processed and the errors are returned together as ValidationErrors.
+func assign(params map[string][]string, fields []field, v interface{}, collect bool) error {
+	errs, err := assignFields(params, fields, reflect.ValueOf(v).Elem(), collect)
+	if err != nil {
+		return unwrapFuncError(err)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// assignFields assigns each field of the structure st. Unless collect is true the first
+// error is returned, otherwise errors caused by the input are returned as ValidationErrors.
+// Cross field comparisons are run once every field has been assigned, fields which were
+// not submitted or failed are not compared.
+func assignFields(params map[string][]string, fields []field, st reflect.Value, collect bool) (ValidationErrors, error) {
+	var errs ValidationErrors
+	var failed map[int]bool
+	for i := range fields {
+		f := &fields[i]
+		// skip parameters which don't have validate markup
+		if f.param == "" {
+			continue
+		}
+		// fields of an optional structure which wasn't submitted are left as they are.
+		if omitted(params, f) {
+			if failed == nil {
+				failed = make(map[int]bool)
+			}
+			failed[i] = true
+			continue
+		}
+
+		var values []string
+		var err error
+		switch {
+		case f.elems != nil:
+			var elemErrs ValidationErrors
+			elemErrs, err = assignElems(params, f, st, collect)
+			errs = append(errs, elemErrs...)
+		case f.typ.Kind() == reflect.Map:
+			var entryErrs ValidationErrors
+			entryErrs, err = assignMap(params, f, st, collect)
+			errs = append(errs, entryErrs...)
+		default:
+			values = params[f.param]
+			if err = checkConditions(params, fields, f); err == nil {
+				err = assignParam(values, f, st)
+			}
+		}
+		if err == nil {
+			continue
+		}
+		// can't set errors are a problem with the structure, not the input.
+		if _, ok := err.(*CantSetError); ok || !collect {
+			return nil, err
+		}
+		errs = append(errs, newParamError(values, f, err))
+		if failed == nil {
+			failed = make(map[int]bool)
+		}
+		failed[i] = true
+	}
+
+	for i := range fields {
+		f := &fields[i]
+		if len(f.compares) == 0 || failed[i] || !hasValue(params, f) {
+			continue
+		}
+		for j := range f.compares {
+			other := findField(fields, f.compares[j].index)
+			if other == -1 || failed[other] || !hasValue(params, &fields[other]) {
+				continue
+			}
+			err := compareFields(&f.compares[j], f, st)
+			if err == nil {
+				continue
+			}
+			if !collect {
+				return nil, err
+			}
+			errs = append(errs, newParamError(params[f.param], f, err))
+		}
+	}
+
+	for i := range fields {
+		err := checkGroups(fields, &fields[i], func(member *field) bool { return hasValue(params, member) })
+		if err == nil {
+			continue
+		}
+		if !collect {
+			return nil, err
+		}
+		errs = append(errs, newParamError(nil, &fields[i], err))
+	}
+	return errs, nil
+}
+
+// checkGroups counts the members of each of the field's groups which have a value.
+func checkGroups(fields []field, f *field, present func(*field) bool) error {
+	for i := range f.groups {
+		g := &f.groups[i]
+		params := make([]string, 0, len(g.index))
+		count := 0
+		for _, index := range g.index {
+			member := findField(fields, index)
+			if member == -1 {
+				continue
+			}
+			params = append(params, fields[member].param)
+			if present(&fields[member]) {
+				count++
+			}
+		}
+		if err := g.check(params, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasValue returns true if a value was submitted for the field or it has a default.
+func hasValue(params map[string][]string, f *field) bool {
+	_, ok := firstValue(params, f)
+	return ok
+}
+
+// firstValue returns the first value submitted for the field after it has been split and
+// transformed, or the field's default.
+func firstValue(params map[string][]string, f *field) (string, bool) {
+	for _, value := range splitValues(params[f.param], f) {
+		if value != "" {
+			return value, true
+		}
+	}
+	if f.defaults != nil {
+		return f.defaults[0], true
+	}
+	return "", false
+}
+
+// checkConditions evaluates the field's conditions against the submitted parameters.
+func checkConditions(params map[string][]string, fields []field, f *field) error {
+	for i := range f.conditions {
+		c := &f.conditions[i]
+		present := make([]bool, len(c.index))
+		var value string
+		for j, index := range c.index {
+			other := findField(fields, index)
+			if other == -1 {
+				continue
+			}
+			v, ok := firstValue(params, &fields[other])
+			present[j] = ok
+			if j == 0 {
+				value = v
+			}
+		}
+		if err := c.check(f, c.met(present, value), hasValue(params, f)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-type CantSetError struct {
-	Param string       // the parameter that is being attempted to be set
-	Type  reflect.Type // the type of the field.
+// findField returns the position in fields of the field with the index, or -1.
+func findField(fields []field, index []int) int {
+	for i := range fields {
+		if reflect.DeepEqual(fields[i].index, index) {
+			return i
+		}
+	}
+	return -1
 }
 
-// Returned when validator is unable to set the type
-func (c *CantSetError) Error() string {
-	return "validate: error attempting to set " + c.Param + " with the Go value of type " + c.Type.String()
+// compareFields runs the comparison of the field against its sibling, nil pointers are
+// not compared.
+func compareFields(c *fieldCompare, f *field, st reflect.Value) error {
+	value, other := st.FieldByIndex(f.index), st.FieldByIndex(c.index)
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if other.Kind() == reflect.Ptr {
+		if other.IsNil() {
+			return nil
+		}
+		other = other.Elem()
+	}
+	return c.compare(f.param, value, other)
 }
 
-type field struct {
-	name       string
-	param      string
-	tags       string
-	typ        reflect.Type
-	optional   bool
-	index      int
-	validators []Validater
-}
+// assignElems assigns a slice of structures from indexed parameters, items[0].name. The
+// slice is allocated up to the largest index submitted and the fields of every element
+// are assigned, so a skipped index reports the required fields of that element.
+func assignElems(params map[string][]string, f *field, st reflect.Value, collect bool) (ValidationErrors, error) {
+	settable := st.FieldByIndex(f.index)
+	if !settable.CanSet() {
+		return nil, &CantSetError{Param: f.param, Type: settable.Type()}
+	}
 
-type cache struct {
-	sync.RWMutex
-	m map[reflect.Type][]field
+	size := 0
+	for param := range params {
+		index, _, ok := elemParam(f.param, param)
+		if !ok {
+			continue
+		}
+		if index > f.maxIndex {
+			return nil, &IndexError{Param: param, Index: index, Max: f.maxIndex}
+		}
+		if index >= size {
+			size = index + 1
+		}
+	}
+
+	if size == 0 {
+		if f.optional {
+			return nil, nil
+		}
+		return nil, &RequiredParamError{Param: f.param, Field: f.name}
+	}
+
+	elems := reflect.MakeSlice(settable.Type(), size, size)
+	if err := runCounts(f, elems.Interface()); err != nil {
+		return nil, err
+	}
+
+	var errs ValidationErrors
+	for i := 0; i < size; i++ {
+		elem := elems.Index(i)
+		if elem.Kind() == reflect.Ptr {
+			elem.Set(reflect.New(elem.Type().Elem()))
+			elem = elem.Elem()
+		}
+		elemErrs, err := assignFields(params, elemFields(f, i), elem, collect)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, elemErrs...)
+	}
+	settable.Set(elems)
+	return errs, nil
 }
 
-var fieldCache cache // for caching field look ups.
+// assignMap assigns a map from the parameters prefixed with the field's parameter,
+// meta[color]=red. The keys are validated by the keys and keymatch tag validators and
+// the values by the validate tag, the same as any other field. Entries are processed in
+// key order so the same input always returns the same error. If collect is true every
+// entry is processed, the errors of each are returned as ValidationErrors and the entries
+// which passed are assigned.
+func assignMap(params map[string][]string, f *field, st reflect.Value, collect bool) (ValidationErrors, error) {
+	settable := st.FieldByIndex(f.index)
+	if !settable.CanSet() {
+		return nil, &CantSetError{Param: f.param, Type: settable.Type()}
+	}
+
+	keys := make([]string, 0)
+	entryParams := make(map[string]string)
+	for param := range params {
+		if key, ok := mapKey(f.param, param); ok {
+			keys = append(keys, key)
+			entryParams[key] = param
+		}
+	}
+	sort.Strings(keys)
 
-// Assign iterates over input map keys and assigns the value to the passed in structure (v),
-// alternatively validating the input.
-func Assign(params map[string][]string, v interface{}) error {
-	fields, err := getFields(v)
-	if err != nil {
-		return err
+	if len(keys) == 0 {
+		if f.optional {
+			return nil, nil
+		}
+		return nil, &RequiredParamError{Param: f.param, Field: f.name}
+	}
+	if err := runCounts(f, keys); err != nil {
+		return nil, err
 	}
 
-	return assign(params, fields, v)
+	var errs ValidationErrors
+	entries := reflect.MakeMapWithSize(settable.Type(), len(keys))
+	for _, key := range keys {
+		entry := entryField(f, key)
+		values := splitValues(params[entryParams[key]], f)
+		err := assignEntry(key, values, &entry, entries)
+		if err == nil {
+			continue
+		}
+		if !collect {
+			return nil, err
+		}
+		errs = append(errs, newParamError(values, f, err))
+	}
+	settable.Set(entries)
+	return errs, nil
 }
 
-// AssignSingle iterates over input map keys with single string values and assigns it to the
-// passed in structure (v), alternatively validating the input.
-func AssignSingle(params map[string]string, v interface{}) error {
-	fields, err := getFields(v)
-	if err != nil {
+// assignEntry validates the key of a map entry and assigns its values to entries.
+func assignEntry(key string, values []string, entry *field, entries reflect.Value) error {
+	for _, validater := range entry.keys {
+		if err := validater.Validate(entry.param, key); err != nil {
+			return err
+		}
+	}
+
+	if len(values) == 0 || len(values) == 1 && values[0] == "" {
+		if entry.optional {
+			return nil
+		}
+		return &RequiredParamError{Param: entry.param, Field: entry.name}
+	}
+
+	value := reflect.New(entries.Type().Elem()).Elem()
+	if err := assignValues(values, entry, value); err != nil {
 		return err
 	}
-	return assignSingle(params, fields, v)
+	entries.SetMapIndex(reflect.ValueOf(key).Convert(entries.Type().Key()), value)
+	return nil
 }
 
-// iterates over each field of the structure and assigns various directives on how to
-// parse, validate and process the value to be assigned to that field.
-// for performance reasons we also store field lookups in a synchronized cache so
-// if we get the same struct many times we only have to analyze the structtags a single
-// time.
-func getFields(v interface{}) ([]field, error) {
-	var err error
-	cacheKey := reflect.TypeOf(v)
-
-	fieldCache.RLock()
-	if fieldCache.m == nil {
-		fieldCache.m = make(map[reflect.Type][]field, 1)
+// assignParam assigns the values of a single parameter to its field.
+func assignParam(values []string, f *field, st reflect.Value) error {
+	values = splitValues(values, f)
+	if f.defaults != nil && (len(values) == 0 || len(values) == 1 && values[0] == "") {
+		values = f.defaults
 	}
-	f := fieldCache.m[cacheKey]
-	fieldCache.RUnlock()
-	if f != nil {
-		//fmt.Printf("We got a cache hit! on %v cache len: %d\n", cacheKey, len(fieldCache.m))
-		return f, nil
+	size := len(values)
+	if size == 0 && f.optional == false {
+		return &RequiredParamError{Param: f.param, Field: f.name}
+	} else if (size == 0 || size == 1 && values[0] == "") && f.optional == true {
+		return nil
 	}
 
-	st := reflect.TypeOf(v).Elem()
-	fields := make([]field, st.NumField())
+	settable := st.FieldByIndex(f.index)
+	if !settable.CanSet() {
+		return &CantSetError{Param: f.param, Type: settable.Type()}
+	}
+	return assignValues(values, f, settable)
+}
 
-	for i := 0; i < st.NumField(); i++ {
-		f := &field{}
-		f.typ = st.Field(i).Type
-		f.name = st.Field(i).Name
-		f.index = i
+// assignValues assigns every value to a slice or array, or the first value to any other kind.
+func assignValues(values []string, f *field, settable reflect.Value) error {
+	converted := f.convert != nil && settable.Type() == f.convertType
+	if !converted && (settable.Kind() == reflect.Slice || settable.Kind() == reflect.Array) {
+		// check how many values were submitted before parsing any of them.
+		if err := runCounts(f, values); err != nil {
+			return err
+		}
+		if settable.Kind() == reflect.Array {
+			if err := checkArrayLen(f, len(values), settable.Len()); err != nil {
+				return err
+			}
+		}
+		if err := assignSlice(values, len(values), f, settable); err != nil {
+			return err
+		}
+		if settable.Kind() == reflect.Array {
+			// elements which weren't submitted are not compared.
+			return checkUnique(f, settable.Slice(0, len(values)))
+		}
+		return checkUnique(f, settable)
+	}
+	// only take the first verify & assign value.
+	return assignField(values[0], f, settable)
+}
 
-		// sets param,optional flags and validators.
-		err = setDirectives(st.Field(i).Tag, f)
-		if err != nil {
-			return nil, err
+// splitValues splits each value on the field's separator if the field has the split
+// directive and runs the field's transforms on each value (or piece of a split value).
+// Empty pieces of a split value are dropped so ids=1,2, is the same as ids=1,2. The
+// input slice is not modified.
+func splitValues(values []string, f *field) []string {
+	if f.split == "" && len(f.transforms) == 0 {
+		return values
+	}
+
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		if f.split == "" {
+			out = append(out, transform(f, value))
+			continue
 		}
-		fields[i] = *f
+		for _, piece := range strings.Split(value, f.split) {
+			if piece = transform(f, piece); piece != "" {
+				out = append(out, piece)
+			}
+		}
+	}
+	return out
+}
+
+// transform runs each of the field's transforms on the value in tag order.
+func transform(f *field, value string) string {
+	for _, transformFn := range f.transforms {
+		value = transformFn(value)
 	}
+	return value
+}
 
-	fieldCache.Lock()
-	fieldCache.m[cacheKey] = fields
-	fieldCache.Unlock()
+// newParamError records which rule caused err for the field.
+func newParamError(values []string, f *field, err error) *ParamError {
+	if ferr, ok := err.(*funcError); ok {
+		err = ferr.validationError()
+	}
+	p := &ParamError{Param: f.param, Field: f.name, Err: err}
+	if len(values) > 0 {
+		p.Value = values[0]
+	}
 
-	return fields, nil
+	// the parameter of the error is more specific for map entries, meta[color].
+	switch e := err.(type) {
+	case *RequiredParamError:
+		p.Param = e.Param
+		p.Rule = "required"
+		if e.Condition != "" {
+			p.Rule = e.Condition
+		}
+	case *ExcludedParamError:
+		p.Rule = e.Condition
+	case *GroupError:
+		p.Param = strings.Join(e.Members, ",")
+		p.Rule = e.Rule
+		p.Value = strconv.Itoa(e.Count)
+	case *TypeError:
+		p.Param = e.Param
+		p.Rule = "type"
+		p.Value = e.Value
+	case *ValidationError:
+		if e.Param != "" {
+			p.Param = e.Param
+		}
+		p.Rule = e.Rule
+		p.Value = e.Value
+	case *IndexError:
+		p.Param = e.Param
+		p.Rule = "index"
+		p.Value = strconv.Itoa(e.Index)
+	}
+	return p
 }
 
-// assignSingle iterates through fields and makes sure it's settable and calls assignField
-func assignSingle(params map[string]string, fields []field, v interface{}) (err error) {
-	st := reflect.ValueOf(v).Elem()
+// zeroWithin returns true if the field belongs to an optional nested structure which
+// holds its zero value.
+func zeroWithin(f *field, st reflect.Value) bool {
+	for _, o := range f.within {
+		if st.FieldByIndex(o.index).IsZero() {
+			return true
+		}
+	}
+	return false
+}
 
-	for _, f := range fields {
+// validateFields checks each tagged field's current value against its validators, then
+// runs the cross field comparisons of fields which don't hold their zero value.
+func validateFields(fields []field, st reflect.Value) error {
+	for i := range fields {
+		f := &fields[i]
 		// skip parameters which don't have validate markup
-		if f.param == "" {
+		if f.param == "" || zeroWithin(f, st) {
 			continue
 		}
-		settable := st.Field(f.index)
-		if !settable.CanSet() {
-			return &CantSetError{Param: f.param, Type: settable.Type()}
+		if err := validateConditions(f, st); err != nil {
+			return err
+		}
+		if err := validateField(f, st.FieldByIndex(f.index)); err != nil {
+			return err
+		}
+	}
+
+	for i := range fields {
+		f := &fields[i]
+		for j := range f.compares {
+			if st.FieldByIndex(f.index).IsZero() || st.FieldByIndex(f.compares[j].index).IsZero() {
+				continue
+			}
+			if err := compareFields(&f.compares[j], f, st); err != nil {
+				return err
+			}
 		}
+	}
 
-		value := params[f.param]
-		if err := assignField(value, &f, settable); err != nil {
+	for i := range fields {
+		err := checkGroups(fields, &fields[i], func(member *field) bool { return !st.FieldByIndex(member.index).IsZero() })
+		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// assign validates fields are settable, parameters aren't empty and that fields set
-// as optional are validated (unless empty, then disregarded).
-func assign(params map[string][]string, fields []field, v interface{}) (err error) {
-	st := reflect.ValueOf(v).Elem()
+// validateConditions evaluates the field's conditions against the current values of the
+// other fields, zero values count as missing.
+func validateConditions(f *field, st reflect.Value) error {
+	for i := range f.conditions {
+		c := &f.conditions[i]
+		present := make([]bool, len(c.index))
+		var value string
+		for j, index := range c.index {
+			other := st.FieldByIndex(index)
+			present[j] = !other.IsZero()
+			if j == 0 && present[j] {
+				value = formatField(other)
+			}
+		}
+		if err := c.check(f, c.met(present, value), !st.FieldByIndex(f.index).IsZero()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	for _, f := range fields {
-		// skip parameters which don't have validate markup
-		if f.param == "" {
-			continue
+// formatField formats the value of a field the same as a submitted parameter.
+func formatField(value reflect.Value) string {
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value.Type() == durationType {
+			return value.Interface().(time.Duration).String()
 		}
-		values := params[f.param]
-		size := len(values)
-		if size == 0 && f.optional == false {
-			return &RequiredParamError{Param: f.param, Field: f.name}
-		} else if (size == 0 || size == 1 && values[0] == "") && f.optional == true {
-			continue
+		return strconv.FormatInt(value.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(value.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, value.Type().Bits())
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool())
+	}
+	return formatValue(value.Interface())
+}
+
+// validateField treats zero values (and empty slices) as missing, otherwise each
+// value is run through the field's validators.
+func validateField(f *field, value reflect.Value) error {
+	if !value.CanSet() {
+		return &CantSetError{Param: f.param, Type: value.Type()}
+	}
+
+	if value.IsZero() || (value.Kind() == reflect.Slice || value.Kind() == reflect.Map) && value.Len() == 0 {
+		if f.optional {
+			return nil
+		}
+		return &RequiredParamError{Param: f.param, Field: f.name}
+	}
+
+	if value.Kind() == reflect.Map {
+		return validateMap(f, value)
+	}
+	return validateValues(f, value)
+}
+
+// validateMap validates the key and value of each entry of the map in key order.
+func validateMap(f *field, value reflect.Value) error {
+	if err := runCounts(f, value.Interface()); err != nil {
+		return err
+	}
+
+	keys := value.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	for _, key := range keys {
+		entry := entryField(f, key.String())
+		for _, validater := range f.keys {
+			if err := validater.Validate(entry.param, key.String()); err != nil {
+				return err
+			}
 		}
 
-		settable := st.Field(f.index)
-		if !settable.CanSet() {
-			return &CantSetError{Param: f.param, Type: settable.Type()}
+		elem := value.MapIndex(key)
+		if elem.IsZero() || elem.Kind() == reflect.Slice && elem.Len() == 0 {
+			if f.optional {
+				continue
+			}
+			return &RequiredParamError{Param: entry.param, Field: entry.name}
+		}
+		if err := validateValues(&entry, elem); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if settable.Kind() == reflect.Slice {
-			err = assignSlice(values, size, &f, settable)
-		} else {
-			// only take the first verify & assign value.
-			err = assignField(values[0], &f, settable)
+// validateValues validates the fields of a slice of structures, each element of other
+// slices or a single value.
+func validateValues(f *field, value reflect.Value) error {
+	if f.elems != nil {
+		return validateElems(f, value)
+	}
+
+	converted := f.convert != nil && value.Type() == f.convertType
+	if !converted && (value.Kind() == reflect.Slice || value.Kind() == reflect.Array) {
+		if err := runCounts(f, value.Interface()); err != nil {
+			return err
 		}
-		// we got an error assigning a type or array, error out.
-		if err != nil {
+		for i := 0; i < value.Len(); i++ {
+			if err := validateValue(f, value.Index(i)); err != nil {
+				return err
+			}
+		}
+		return checkUnique(f, value)
+	}
+	return validateValue(f, value)
+}
+
+// validateElems validates the fields of each element of a slice of structures, nil
+// elements are skipped.
+func validateElems(f *field, value reflect.Value) error {
+	if err := runCounts(f, value.Interface()); err != nil {
+		return err
+	}
+	for i := 0; i < value.Len(); i++ {
+		elem := value.Index(i)
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				continue
+			}
+			elem = elem.Elem()
+		}
+		if err := validateFields(elemFields(f, i), elem); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// validateValue passes the value to the validators in the same form verifiedAssign does.
+func validateValue(f *field, value reflect.Value) error {
+	if f.convert != nil && value.Type() == f.convertType {
+		return runValidators(f, value.Interface())
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		// nil elements of a slice have nothing to validate.
+		if value.IsNil() {
+			return nil
+		}
+		return validateValue(f, value.Elem())
+	case reflect.String:
+		return runValidators(f, value.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return runValidators(f, value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return runValidators(f, value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return runValidators(f, value.Float())
+	case reflect.Bool:
+		return runValidators(f, value.Bool())
+	default:
+		return fmt.Errorf("validate: error %v is not a supported type for parameter %s.", value.Type(), f.param)
+	}
+}
+
 // assignField checks if the field is required, returns an error if it is but missing
 // or calls verifiedAssign to continue processing.
 func assignField(value string, f *field, settable reflect.Value) error {
@@ -221,8 +1484,23 @@ func assignField(value string, f *field, settable reflect.Value) error {
 	return verifiedAssign(value, f, settable)
 }
 
+// checkArrayLen returns a ValidationError unless exactly as many values as the length
+// of the array were submitted. Fields with the partial directive may submit fewer.
+func checkArrayLen(f *field, size, length int) error {
+	if size == length || size < length && f.partial {
+		return nil
+	}
+	return &ValidationError{Param: f.param, Value: strconv.Itoa(size), Rule: "array"}
+}
+
+// assignSlice assigns each value to an element of a new slice, arrays are reset to their
+// zero value first.
 func assignSlice(values []string, size int, f *field, settable reflect.Value) error {
-	settable.Set(reflect.MakeSlice(reflect.SliceOf(settable.Type().Elem()), size, size))
+	if settable.Kind() == reflect.Array {
+		settable.Set(reflect.Zero(settable.Type()))
+	} else {
+		settable.Set(reflect.MakeSlice(reflect.SliceOf(settable.Type().Elem()), size, size))
+	}
 	for i, val := range values {
 		if err := verifiedAssign(val, f, settable.Index(i)); err != nil {
 			return err
@@ -235,59 +1513,60 @@ func assignSlice(values []string, size int, f *field, settable reflect.Value) er
 // Then it will run validators against the reflected type to make sure they pass.
 // provided they do, the value will be assigned to the structure.
 // NOTE: we also check for numerical overflows.
+// Pointer fields are only allocated once the value has been verified, so they stay
+// nil when the parameter is absent.
 func verifiedAssign(s string, f *field, settable reflect.Value) error {
+	// registered converters and TextUnmarshalers take precedence over the built in kinds.
+	if f.convert != nil && settable.Type() == f.convertType {
+		return convertAssign(s, f, settable)
+	}
+
 	switch settable.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(settable.Type().Elem())
+		if err := verifiedAssign(s, f, elem.Elem()); err != nil {
+			return err
+		}
+		settable.Set(elem)
 	case reflect.String:
-		//fmt.Printf("In string case validators len: %d\n", len(f.validation.Validaters))
-		for _, validater := range f.validators {
-			if err := validater.Validate(f.param, s); err != nil {
-				return err
-			}
+		if err := runValidators(f, s); err != nil {
+			return err
 		}
 		settable.SetString(s)
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		n, err := strconv.ParseInt(s, 10, 64)
 		if err != nil || settable.OverflowInt(n) {
-			return &TypeError{f.param, s, settable.Type()}
+			return &TypeError{Param: f.param, Value: s, Type: settable.Type()}
 		}
-
-		for _, validater := range f.validators {
-			if err := validater.Validate(f.param, n); err != nil {
-				return err
-			}
+		if err := runValidators(f, n); err != nil {
+			return err
 		}
 		settable.SetInt(n)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		n, err := strconv.ParseUint(s, 10, 64)
 		if err != nil || settable.OverflowUint(n) {
-			return &TypeError{f.param, s, settable.Type()}
+			return &TypeError{Param: f.param, Value: s, Type: settable.Type()}
 		}
-		for _, validater := range f.validators {
-			if err := validater.Validate(f.param, n); err != nil {
-				return err
-			}
+		if err := runValidators(f, n); err != nil {
+			return err
 		}
 		settable.SetUint(n)
 	case reflect.Float32, reflect.Float64:
 		n, err := strconv.ParseFloat(s, settable.Type().Bits())
 		if err != nil || settable.OverflowFloat(n) {
-			return &TypeError{f.param, s, settable.Type()}
+			return &TypeError{Param: f.param, Value: s, Type: settable.Type()}
 		}
-		for _, validater := range f.validators {
-			if err := validater.Validate(f.param, n); err != nil {
-				return err
-			}
+		if err := runValidators(f, n); err != nil {
+			return err
 		}
 		settable.SetFloat(n)
 	case reflect.Bool:
 		n, err := strconv.ParseBool(s)
 		if err != nil {
-			return &TypeError{f.param, s, settable.Type()}
+			return &TypeError{Param: f.param, Value: s, Type: settable.Type()}
 		}
-		for _, validater := range f.validators {
-			if err := validater.Validate(f.param, n); err != nil {
-				return err
-			}
+		if err := runValidators(f, n); err != nil {
+			return err
 		}
 		settable.SetBool(n)
 	default:
@@ -295,3 +1574,84 @@ func verifiedAssign(s string, f *field, settable reflect.Value) error {
 	}
 	return nil
 }
+
+// convertAssign uses the field's converter to turn s in to a Go value, the converted
+// value is what the validators are run against.
+func convertAssign(s string, f *field, settable reflect.Value) error {
+	n, err := f.convert(s)
+	if err != nil {
+		return &TypeError{Param: f.param, Value: s, Type: settable.Type()}
+	}
+
+	converted := reflect.ValueOf(n)
+	if !converted.IsValid() || !converted.Type().AssignableTo(settable.Type()) {
+		return fmt.Errorf("validate: error converter for %v returned %T for parameter %s.", settable.Type(), n, f.param)
+	}
+
+	if err := runValidators(f, n); err != nil {
+		return err
+	}
+	settable.Set(converted)
+	return nil
+}
+
+// runCounts runs the field's count validators against the slice of values.
+func runCounts(f *field, values interface{}) error {
+	for _, validater := range f.counts {
+		if err := validater.Validate(f.param, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkUnique returns a ValidationError for the first repeated element of the slice if the
+// field has the unique directive. Pointers are compared by the value they point to and
+// types which can't be map keys, such as net.IP, are compared with reflect.DeepEqual.
+func checkUnique(f *field, slice reflect.Value) error {
+	if !f.unique {
+		return nil
+	}
+
+	seen := make(map[interface{}]bool, slice.Len())
+	var unhashable []interface{}
+	for i := 0; i < slice.Len(); i++ {
+		elem := slice.Index(i)
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				continue
+			}
+			elem = elem.Elem()
+		}
+
+		key := elem.Interface()
+		if t, ok := key.(time.Time); ok {
+			// compare instants, not locations or monotonic readings.
+			key = t.Round(0).UTC()
+		}
+		if !elem.Type().Comparable() {
+			for _, prev := range unhashable {
+				if reflect.DeepEqual(prev, key) {
+					return &ValidationError{Param: f.param, Value: formatValue(key), Rule: "unique"}
+				}
+			}
+			unhashable = append(unhashable, key)
+			continue
+		}
+		if seen[key] {
+			return &ValidationError{Param: f.param, Value: formatValue(key), Rule: "unique"}
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// runValidators runs each of the field's validators against the parsed value.
+func runValidators(f *field, value interface{}) error {
+	for _, validater := range f.validators {
+		if err := validater.Validate(f.param, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
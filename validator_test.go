@@ -2,8 +2,15 @@ package validator
 
 import (
 	"encoding/hex"
+	"errors"
+	"net"
+	"net/netip"
 	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func hashCheck(hash string) error {
@@ -426,6 +433,1382 @@ func TestAssignSingle(t *testing.T) {
 	}
 }
 
+func TestAssignAll(t *testing.T) {
+	params, _ := url.ParseQuery("name=someone1&state=AZZ&age=abc")
+	st := &RequiredUser{}
+	err := AssignAll(params, st)
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("error: expected ValidationErrors got: %v\n", err)
+	}
+	if len(errs) != 3 {
+		t.Fatalf("error: expected 3 errors got %d: %v\n", len(errs), errs)
+	}
+
+	// errors are returned in field order.
+	if errs[0].Field != "Name" || errs[0].Rule != "regex" || errs[0].Value != "someone1" {
+		t.Fatalf("error: name error not reported correctly: %#v\n", errs[0])
+	}
+	if errs[1].Field != "Age" || errs[1].Rule != "type" || errs[1].Value != "abc" {
+		t.Fatalf("error: age error not reported correctly: %#v\n", errs[1])
+	}
+	if errs[2].Field != "State" || errs[2].Rule != "len(2:2)" {
+		t.Fatalf("error: state error not reported correctly: %#v\n", errs[2])
+	}
+
+	var typeErr *TypeError
+	if !errors.As(err, &typeErr) || typeErr.Param != "age" {
+		t.Fatalf("error: errors.As did not find the TypeError: %v\n", err)
+	}
+
+	single := map[string]string{"name": "john", "state": "MA"}
+	st = &RequiredUser{}
+	err = AssignSingleAll(single, st)
+	var reqErr *RequiredParamError
+	if !errors.As(err, &reqErr) || reqErr.Field != "Age" {
+		t.Fatalf("error: expected a RequiredParamError for age got: %v\n", err)
+	}
+	if st.Name != "john" || st.State != "MA" {
+		t.Fatalf("error: valid fields were not assigned: %v\n", st)
+	}
+
+	params, _ = url.ParseQuery("name=someone&state=AZ&age=3")
+	st = &RequiredUser{}
+	if err := AssignAll(params, st); err != nil {
+		t.Fatalf("error: valid input failed: %v\n", err)
+	}
+
+	// Assign returns the error of a custom function as is, AssignAll reports its rule.
+	errOne := errors.New("not one")
+	v := New()
+	v.Add("isolated", func(s string) error {
+		if s != "one" {
+			return errOne
+		}
+		return nil
+	})
+	params, _ = url.ParseQuery("code=two")
+	if err := v.Assign(params, &InstanceForm{}); err != errOne {
+		t.Fatalf("error: expected the custom function's error got: %v\n", err)
+	}
+	errs, _ = v.AssignAll(params, &InstanceForm{}).(ValidationErrors)
+	if len(errs) != 1 || errs[0].Rule != "isolated" || errs[0].Value != "two" || !errors.Is(errs[0], errOne) {
+		t.Fatalf("error: custom function error not reported correctly: %v\n", errs)
+	}
+}
+
+type InstanceForm struct {
+	Code string `validate:"code,isolated"`
+}
+
+func TestValidatorInstances(t *testing.T) {
+	v1 := New()
+	v2 := New()
+	v1.Add("isolated", func(s string) error {
+		if s != "one" {
+			return errors.New("not one")
+		}
+		return nil
+	})
+	v2.Add("isolated", func(s string) error {
+		if s != "two" {
+			return errors.New("not two")
+		}
+		return nil
+	})
+
+	params, _ := url.ParseQuery("code=one")
+	if err := v1.Assign(params, &InstanceForm{}); err != nil {
+		t.Fatalf("error: v1 failed valid input: %v\n", err)
+	}
+	if err := v2.Assign(params, &InstanceForm{}); err == nil {
+		t.Fatalf("error: v2 used the function registered with v1\n")
+	}
+
+	// the default validator never had isolated registered.
+	if _, ok := std.fns.Funcs["isolated"]; ok {
+		t.Fatalf("error: instance registration leaked into the default validator\n")
+	}
+	if _, ok := std.fieldCache.m[reflect.TypeOf(&InstanceForm{})]; ok {
+		t.Fatalf("error: instance field cache leaked into the default validator\n")
+	}
+}
+
+type Address struct {
+	City string `validate:"city,len(2:20)"`
+	Zip  string `validate:"zip" regex:"^[0-9]{5}$"`
+	Note string `validate:"note,optional"`
+}
+
+type Location struct {
+	Point struct {
+		Lat float64 `validate:"lat,range(-90:90)"`
+	} `validate:"point"`
+}
+
+type NestedUser struct {
+	Name     string   `validate:"name"`
+	Address  Address  `validate:"address"`
+	Location Location `validate:"loc"`
+	Ignored  Address
+}
+
+func TestNestedStructs(t *testing.T) {
+	params, _ := url.ParseQuery("name=john&address.city=Boston&address.zip=02134&loc.point.lat=42.3&city=Nowhere")
+	st := &NestedUser{}
+	if err := Assign(params, st); err != nil {
+		t.Fatalf("error: nested struct failed to assign: %v\n", err)
+	}
+	if st.Address.City != "Boston" || st.Address.Zip != "02134" || st.Location.Point.Lat != 42.3 {
+		t.Fatalf("error: nested fields not assigned: %v\n", st)
+	}
+	if st.Ignored.City != "" {
+		t.Fatalf("error: untagged struct field was assigned: %v\n", st)
+	}
+
+	params, _ = url.ParseQuery("name=john&address.city=Boston&address.zip=abc&loc.point.lat=42.3")
+	st = &NestedUser{}
+	err := Assign(params, st)
+	verr, ok := err.(*ValidationError)
+	if !ok || verr.Param != "address.zip" {
+		t.Fatalf("error: expected validation error for address.zip got: %v\n", err)
+	}
+
+	params, _ = url.ParseQuery("name=john&address.zip=02134&loc.point.lat=42.3")
+	st = &NestedUser{}
+	err = Assign(params, st)
+	rerr, ok := err.(*RequiredParamError)
+	if !ok || rerr.Param != "address.city" || rerr.Field != "Address.City" {
+		t.Fatalf("error: expected required error for address.city got: %v\n", err)
+	}
+}
+
+type OptionalAddressUser struct {
+	Name    string  `validate:"name"`
+	Billing Address `validate:"billing,optional"`
+}
+
+type BadNestedUser struct {
+	Address Address `validate:"address,unique"`
+}
+
+func TestOptionalNestedStructs(t *testing.T) {
+	params, _ := url.ParseQuery("name=john")
+	st := &OptionalAddressUser{}
+	if err := Assign(params, st); err != nil {
+		t.Fatalf("error: absent optional structure should be skipped: %v\n", err)
+	}
+	if err := Validate(st); err != nil {
+		t.Fatalf("error: zero optional structure should be skipped: %v\n", err)
+	}
+
+	// once any of its parameters is sent the structure's fields are required as usual.
+	params, _ = url.ParseQuery("name=john&billing.zip=02134")
+	err := Assign(params, &OptionalAddressUser{})
+	if rerr, ok := err.(*RequiredParamError); !ok || rerr.Param != "billing.city" {
+		t.Fatalf("error: expected required error for billing.city got: %v\n", err)
+	}
+	st.Billing.Zip = "02134"
+	if _, ok := Validate(st).(*RequiredParamError); !ok {
+		t.Fatalf("error: partly filled optional structure should be validated\n")
+	}
+
+	if err := Precompile(&BadNestedUser{}); err == nil {
+		t.Fatalf("error: unique on a structure field should not compile\n")
+	}
+}
+
+type PatchUser struct {
+	Name   *string  `validate:"name,optional,len(2:10)"`
+	Age    *int     `validate:"age,optional,range(1:120)"`
+	Admin  *bool    `validate:"admin,optional"`
+	Scores []*int64 `validate:"score,optional,range(0:100)"`
+}
+
+func TestPointerFields(t *testing.T) {
+	params, _ := url.ParseQuery("age=0")
+	st := &PatchUser{}
+	err := Assign(params, st)
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("error: range was not checked against the dereferenced value: %v\n", err)
+	}
+
+	params, _ = url.ParseQuery("age=31&admin=false&score=1&score=99")
+	st = &PatchUser{}
+	if err := Assign(params, st); err != nil {
+		t.Fatalf("error: pointer fields failed to assign: %v\n", err)
+	}
+	if st.Name != nil {
+		t.Fatalf("error: absent optional name should be nil\n")
+	}
+	if st.Age == nil || *st.Age != 31 {
+		t.Fatalf("error: age not assigned: %v\n", st.Age)
+	}
+	if st.Admin == nil || *st.Admin != false {
+		t.Fatalf("error: admin false should still be set: %v\n", st.Admin)
+	}
+	if len(st.Scores) != 2 || *st.Scores[1] != 99 {
+		t.Fatalf("error: scores not assigned: %v\n", st.Scores)
+	}
+
+	params, _ = url.ParseQuery("name=a")
+	st = &PatchUser{}
+	if err := Assign(params, st); err == nil || st.Name != nil {
+		t.Fatalf("error: short name passed validation or was assigned\n")
+	}
+}
+
+type Level int
+
+func (l *Level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return errors.New("unknown level")
+	}
+	return nil
+}
+
+type Cents int64
+
+func parseCents(s string) (interface{}, error) {
+	f, err := strconv.ParseFloat(strings.TrimPrefix(s, "$"), 64)
+	if err != nil {
+		return nil, err
+	}
+	return Cents(f * 100), nil
+}
+
+type ConvertForm struct {
+	Addr   netip.Addr    `validate:"addr"`
+	Hosts  []*netip.Addr `validate:"host,optional"`
+	Level  Level         `validate:"level,range(1:1)"`
+	Price  Cents         `validate:"price,range(1:10000)"`
+	Prices []Cents       `validate:"prices,optional"`
+}
+
+func TestConverters(t *testing.T) {
+	v := New()
+	v.RegisterConverter(reflect.TypeOf(Cents(0)), parseCents)
+
+	params, _ := url.ParseQuery("addr=10.0.0.1&host=::1&host=127.0.0.1&level=low&price=$1.50&prices=2&prices=$3.25")
+	st := &ConvertForm{}
+	if err := v.Assign(params, st); err != nil {
+		t.Fatalf("error: converted fields failed to assign: %v\n", err)
+	}
+	if st.Addr != netip.MustParseAddr("10.0.0.1") || len(st.Hosts) != 2 || !st.Hosts[0].Is6() {
+		t.Fatalf("error: TextUnmarshaler fields not assigned: %v\n", st)
+	}
+	if st.Level != 1 || st.Price != 150 || st.Prices[1] != 325 {
+		t.Fatalf("error: converted values not assigned: %v\n", st)
+	}
+
+	// validators run against the converted value.
+	params, _ = url.ParseQuery("addr=10.0.0.1&level=high&price=1")
+	err := v.Assign(params, &ConvertForm{})
+	if verr, ok := err.(*ValidationError); !ok || verr.Param != "level" {
+		t.Fatalf("error: expected level to fail range got: %v\n", err)
+	}
+
+	params, _ = url.ParseQuery("addr=10.0.0.999&level=low&price=1")
+	err = v.Assign(params, &ConvertForm{})
+	if terr, ok := err.(*TypeError); !ok || terr.Param != "addr" {
+		t.Fatalf("error: expected type error for addr got: %v\n", err)
+	}
+
+	params, _ = url.ParseQuery("addr=10.0.0.1&level=low&price=$0.001")
+	err = v.Assign(params, &ConvertForm{})
+	if verr, ok := err.(*ValidationError); !ok || verr.Param != "price" {
+		t.Fatalf("error: expected price to fail range got: %v\n", err)
+	}
+}
+
+type EventForm struct {
+	Start   time.Time     `validate:"start,layout(date),after(2000-01-01),before(2030-01-01)"`
+	Stamp   time.Time     `validate:"stamp,optional"`
+	Day     *time.Time    `validate:"day,optional,layout(Jan 2, 2006)"`
+	Recent  time.Time     `validate:"recent,optional,layout(rfc3339),within(-720h:1m)"`
+	Future  time.Time     `validate:"future,optional,after(now)"`
+	Timeout time.Duration `validate:"timeout,range(1s:1h)"`
+	Lenient string        `validate:"lenient,optional,lenient"`
+}
+
+func TestTimeFields(t *testing.T) {
+	v := New()
+	v.Add("lenient", func(string) error { return nil })
+
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	params := url.Values{}
+	params.Set("start", "2014-01-28")
+	params.Set("stamp", "2014-01-28T10:00:00Z")
+	params.Set("day", "Jan 28, 2014")
+	params.Set("recent", recent)
+	params.Set("timeout", "90s")
+	params.Set("lenient", "whatever")
+	st := &EventForm{}
+	if err := v.Assign(params, st); err != nil {
+		t.Fatalf("error: time fields failed to assign: %v\n", err)
+	}
+	if st.Start != time.Date(2014, 1, 28, 0, 0, 0, 0, time.UTC) || st.Stamp.Hour() != 10 {
+		t.Fatalf("error: times not assigned: %v\n", st)
+	}
+	if st.Day == nil || st.Day.Day() != 28 || st.Timeout != 90*time.Second {
+		t.Fatalf("error: day or timeout not assigned: %v\n", st)
+	}
+
+	bad := map[string]string{
+		"start":   "2031-01-01",
+		"day":     "2014-01-28",
+		"recent":  "2000-01-01T00:00:00Z",
+		"future":  "2000-01-01T00:00:00Z",
+		"timeout": "2h",
+	}
+	for param, value := range bad {
+		failing := url.Values{}
+		failing.Set("start", "2014-01-28")
+		failing.Set("timeout", "1m")
+		failing.Set(param, value)
+		if err := v.Assign(failing, &EventForm{}); err == nil {
+			t.Fatalf("error: %s=%s passed validation\n", param, value)
+		}
+	}
+
+	// durations are reported as durations, not nanoseconds.
+	params = url.Values{"start": {"2014-01-28"}, "timeout": {"90m"}}
+	if verr, ok := v.Assign(params, &EventForm{}).(*ValidationError); !ok || verr.Value != "1h30m0s" {
+		t.Fatalf("error: expected the duration to be reported as 1h30m0s got: %v\n", verr)
+	}
+}
+
+type BadLayoutForm struct {
+	Name string `validate:"name,layout(date)"`
+}
+
+type BadWithinForm struct {
+	When time.Time `validate:"when,within(1h:-1h)"`
+}
+
+func TestBadTimeDirectives(t *testing.T) {
+	params, _ := url.ParseQuery("name=x&when=2014-01-28T10:00:00Z")
+	if _, ok := Assign(params, &BadLayoutForm{}).(*FuncTypeError); !ok {
+		t.Fatalf("error: layout on a string field should be a FuncTypeError\n")
+	}
+	if _, ok := Assign(params, &BadWithinForm{}).(*FuncError); !ok {
+		t.Fatalf("error: within with min > max should be a FuncError\n")
+	}
+}
+
+type ValidateForm struct {
+	Name    string    `validate:"name,len(2:10)" regex:"^[a-z]*$"`
+	Age     *int      `validate:"age,optional,range(1:120)"`
+	Tags    []string  `validate:"tags,optional,len(1:5)"`
+	Created time.Time `validate:"created,optional,before(now)"`
+	Address Address   `validate:"address"`
+}
+
+func TestValidate(t *testing.T) {
+	age := 30
+	st := &ValidateForm{
+		Name:    "john",
+		Age:     &age,
+		Tags:    []string{"a", "bc"},
+		Created: time.Now().Add(-time.Hour),
+		Address: Address{City: "Boston", Zip: "02134"},
+	}
+	if err := Validate(st); err != nil {
+		t.Fatalf("error: valid struct failed validation: %v\n", err)
+	}
+	if st.Name != "john" || *st.Age != 30 {
+		t.Fatalf("error: Validate modified the structure: %v\n", st)
+	}
+
+	age = 130
+	if verr, ok := Validate(st).(*ValidationError); !ok || verr.Param != "age" {
+		t.Fatalf("error: expected age to fail validation\n")
+	}
+	age = 30
+
+	st.Tags = append(st.Tags, "toolong")
+	if verr, ok := Validate(st).(*ValidationError); !ok || verr.Param != "tags" {
+		t.Fatalf("error: expected tags to fail validation\n")
+	}
+	st.Tags = nil
+
+	st.Address.Zip = "abc"
+	if verr, ok := Validate(st).(*ValidationError); !ok || verr.Param != "address.zip" {
+		t.Fatalf("error: expected address.zip to fail validation\n")
+	}
+	st.Address.Zip = "02134"
+
+	// structures may be passed by value.
+	if err := Validate(*st); err != nil {
+		t.Fatalf("error: valid struct value failed validation: %v\n", err)
+	}
+
+	st.Name = ""
+	if _, ok := Validate(st).(*RequiredParamError); !ok {
+		t.Fatalf("error: expected empty required name to be reported\n")
+	}
+	if _, ok := Validate(*st).(*RequiredParamError); !ok {
+		t.Fatalf("error: expected empty required name of a struct value to be reported\n")
+	}
+
+	var nilForm *ValidateForm
+	for _, v := range []interface{}{nil, nilForm, "form", &age} {
+		if err := Validate(v); err == nil {
+			t.Fatalf("error: expected %#v to be rejected\n", v)
+		}
+	}
+}
+
+func TestStrict(t *testing.T) {
+	v := New(Strict("csrf_token"))
+
+	params, _ := url.ParseQuery("name=john&address.city=Boston&address.zip=02134&loc.point.lat=1&csrf_token=abc")
+	if err := v.Assign(params, &NestedUser{}); err != nil {
+		t.Fatalf("error: strict validator rejected known params: %v\n", err)
+	}
+
+	params, _ = url.ParseQuery("name=john&address.city=Boston&address.zip=02134&loc.point.lat=1&is_admin=1&address.state=MA")
+	st := &NestedUser{}
+	err := v.Assign(params, st)
+	uerr, ok := err.(*UnknownParamError)
+	if !ok {
+		t.Fatalf("error: expected UnknownParamError got: %v\n", err)
+	}
+	if len(uerr.Params) != 2 || uerr.Params[0] != "address.state" || uerr.Params[1] != "is_admin" {
+		t.Fatalf("error: unknown params not listed correctly: %v\n", uerr.Params)
+	}
+	if st.Name != "" {
+		t.Fatalf("error: fields were assigned even though the input was rejected\n")
+	}
+
+	single := map[string]string{"name": "john", "age": "3", "state": "MA", "extra": "1"}
+	if _, ok := v.AssignSingle(single, &RequiredUser{}).(*UnknownParamError); !ok {
+		t.Fatalf("error: expected UnknownParamError from AssignSingle\n")
+	}
+
+	// the default validator ignores unknown params.
+	if err := AssignSingle(single, &RequiredUser{}); err != nil {
+		t.Fatalf("error: non strict validator rejected unknown params: %v\n", err)
+	}
+}
+
+type TypoForm struct {
+	Name  string `validate:"name,lne(1:2)"`
+	Age   int    `validate:"age,range(5:1)"`
+	State string `validate:"state,len(2:2)"`
+}
+
+type OtherTypoForm struct {
+	Code  string  `validate:"code,notregistered"`
+	Inner Address `validate:"inner"`
+}
+
+func TestUnknownDirective(t *testing.T) {
+	params, _ := url.ParseQuery("name=ab&age=3&state=MA")
+	err := Assign(params, &TypoForm{})
+	derr, ok := err.(*UnknownDirectiveError)
+	if !ok || derr.Field != "Name" || derr.Directive != "lne(1:2)" {
+		t.Fatalf("error: expected UnknownDirectiveError got: %v\n", err)
+	}
+}
+
+func TestPrecompile(t *testing.T) {
+	v := New()
+	if err := v.Precompile(&User{}, NestedUser{}, &EventForm{}); err == nil || !strings.Contains(err.Error(), "lenient") {
+		t.Fatalf("error: unregistered lenient directive was not reported: %v\n", err)
+	}
+	v.Add("lenient", func(string) error { return nil })
+	if err := v.Precompile(&User{}, NestedUser{}, &EventForm{}); err != nil {
+		t.Fatalf("error: valid structures failed to precompile: %v\n", err)
+	}
+	if _, ok := v.fieldCache.m[reflect.TypeOf(&NestedUser{})]; !ok {
+		t.Fatalf("error: precompiled fields were not cached\n")
+	}
+
+	err := v.Precompile(&TypoForm{}, &OtherTypoForm{}, 5)
+	errs, ok := err.(CompileErrors)
+	if !ok || len(errs) != 4 {
+		t.Fatalf("error: expected 4 compile errors got: %v\n", err)
+	}
+	var derr *UnknownDirectiveError
+	if !errors.As(errs[2], &derr) || derr.Directive != "notregistered" || errs[2].Type != reflect.TypeOf(OtherTypoForm{}) {
+		t.Fatalf("error: unknown directive on OtherTypoForm not reported: %v\n", errs[2])
+	}
+	var ferr *FuncError
+	if !errors.As(err, &ferr) {
+		t.Fatalf("error: range(5:1) not reported: %v\n", err)
+	}
+
+	if err := v.Precompile(nil); err == nil || !strings.Contains(err.Error(), "is not a structure") {
+		t.Fatalf("error: nil not reported: %v\n", err)
+	}
+
+	func() {
+		defer func() {
+			if err, ok := recover().(error); !ok || !strings.Contains(err.Error(), "is not a structure") {
+				t.Fatalf("error: MustPrecompile(nil) did not panic with the compile error: %v\n", err)
+			}
+		}()
+		v.MustPrecompile(nil)
+	}()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("error: MustPrecompile did not panic\n")
+		}
+	}()
+	v.MustPrecompile(&TypoForm{})
+}
+
+type SelectForm struct {
+	Color  string    `validate:"color,oneof(red|green|blue)"`
+	Size   string    `validate:"size,optional,oneofci(S|M|L)"`
+	Qty    int       `validate:"qty,optional,oneof(1|5|10)"`
+	Rating uint8     `validate:"rating,optional,oneof(1|2|3)"`
+	Ratio  float64   `validate:"ratio,optional,oneof(0.5|1.5)"`
+	Small  float32   `validate:"small,optional,oneof(0.1|0.3)"`
+	Tags   []string  `validate:"tag,optional,oneof(a|b)"`
+	Opts   []*string `validate:"opt,optional,oneofci(x|y)"`
+}
+
+type BadOneOfForm struct {
+	Qty int `validate:"qty,oneofci(1|2)"`
+}
+
+type BadOneOfValueForm struct {
+	Qty int `validate:"qty,oneof(1|two)"`
+}
+
+func TestOneOf(t *testing.T) {
+	params, _ := url.ParseQuery("color=red&size=m&qty=5&rating=3&ratio=1.5&small=0.1&tag=a&tag=b&opt=X")
+	st := &SelectForm{}
+	if err := Assign(params, st); err != nil {
+		t.Fatalf("error: valid oneof values failed: %v\n", err)
+	}
+	if err := Validate(st); err != nil {
+		t.Fatalf("error: valid oneof values failed Validate: %v\n", err)
+	}
+	if st.Size != "m" || st.Qty != 5 || *st.Opts[0] != "X" {
+		t.Fatalf("error: oneof values not assigned: %v\n", st)
+	}
+
+	bad := map[string]string{"color": "Red", "qty": "2", "rating": "4", "ratio": "1", "small": "0.2", "tag": "c", "size": "xl"}
+	for param, value := range bad {
+		params, _ := url.ParseQuery("color=red")
+		params.Set(param, value)
+		err := Assign(params, &SelectForm{})
+		verr, ok := err.(*ValidationError)
+		if !ok || verr.Param != param || len(verr.Allowed) == 0 {
+			t.Fatalf("error: expected %s=%s to fail oneof got: %v\n", param, value, err)
+		}
+	}
+
+	params, _ = url.ParseQuery("color=purple")
+	err := Assign(params, &SelectForm{})
+	if verr, ok := err.(*ValidationError); !ok || strings.Join(verr.Allowed, ",") != "red,green,blue" {
+		t.Fatalf("error: allowed values not reported: %v\n", err)
+	}
+
+	if _, ok := Assign(params, &BadOneOfForm{}).(*FuncTypeError); !ok {
+		t.Fatalf("error: oneofci on an int field should be a FuncTypeError\n")
+	}
+	if _, ok := Assign(params, &BadOneOfValueForm{}).(*FuncError); !ok {
+		t.Fatalf("error: non numeric oneof value on an int field should be a FuncError\n")
+	}
+}
+
+type MultiSelectForm struct {
+	Colors []string `validate:"color,count(1:3),unique,oneof(red|green|blue|black)"`
+	IDs    []*int   `validate:"id,optional,minitems(2),unique"`
+	Tags   []string `validate:"tag,optional,maxitems(2)"`
+}
+
+type BadCountForm struct {
+	Color string `validate:"color,count(1:3)"`
+}
+
+func TestSliceCardinality(t *testing.T) {
+	params, _ := url.ParseQuery("color=red&color=blue&id=1&id=2&tag=a")
+	st := &MultiSelectForm{}
+	if err := Assign(params, st); err != nil {
+		t.Fatalf("error: valid multi select failed: %v\n", err)
+	}
+	if len(st.Colors) != 2 || len(st.IDs) != 2 {
+		t.Fatalf("error: slices not assigned: %v\n", st)
+	}
+
+	params, _ = url.ParseQuery("color=red&color=blue&color=green&color=black")
+	err := Assign(params, &MultiSelectForm{})
+	if verr, ok := err.(*ValidationError); !ok || verr.Rule != "count(1:3)" || verr.Value != "4" {
+		t.Fatalf("error: expected count to fail got: %v\n", err)
+	}
+
+	// count is checked before the elements are parsed.
+	params, _ = url.ParseQuery("color=x&color=x&color=x&color=x")
+	if verr, ok := Assign(params, &MultiSelectForm{}).(*ValidationError); !ok || verr.Rule != "count(1:3)" {
+		t.Fatalf("error: elements were validated before count\n")
+	}
+
+	params, _ = url.ParseQuery("color=red&color=red")
+	err = Assign(params, &MultiSelectForm{})
+	if verr, ok := err.(*ValidationError); !ok || verr.Rule != "unique" || verr.Value != "red" {
+		t.Fatalf("error: expected unique to fail got: %v\n", err)
+	}
+
+	params, _ = url.ParseQuery("color=red&id=1&id=01")
+	if verr, ok := Assign(params, &MultiSelectForm{}).(*ValidationError); !ok || verr.Rule != "unique" {
+		t.Fatalf("error: parsed duplicate ids were not rejected\n")
+	}
+
+	params, _ = url.ParseQuery("color=red&id=1")
+	if verr, ok := Assign(params, &MultiSelectForm{}).(*ValidationError); !ok || verr.Rule != "minitems(2)" {
+		t.Fatalf("error: minitems did not fail\n")
+	}
+
+	params, _ = url.ParseQuery("color=red&tag=a&tag=b&tag=c")
+	if verr, ok := Assign(params, &MultiSelectForm{}).(*ValidationError); !ok || verr.Rule != "maxitems(2)" {
+		t.Fatalf("error: maxitems did not fail\n")
+	}
+
+	st = &MultiSelectForm{Colors: []string{"red", "red"}}
+	if verr, ok := Validate(st).(*ValidationError); !ok || verr.Rule != "unique" {
+		t.Fatalf("error: Validate did not check unique\n")
+	}
+
+	if _, ok := Assign(params, &BadCountForm{}).(*FuncTypeError); !ok {
+		t.Fatalf("error: count on a string field should be a FuncTypeError\n")
+	}
+}
+
+type SplitForm struct {
+	IDs    []int    `validate:"ids,split(,),count(1:4),range(1:100)"`
+	Tags   []string `validate:"tags,optional,split(|),trim,len(1:5)"`
+	Name   string   `validate:"name,optional,trim"`
+	Spaced []string `validate:"spaced,optional,split( )"`
+}
+
+type BadSplitForm struct {
+	ID int `validate:"id,split(,)"`
+}
+
+func TestSplit(t *testing.T) {
+	params, _ := url.ParseQuery("ids=1,2,3,&tags=a | b|c &name= john &spaced=x y")
+	st := &SplitForm{}
+	if err := Assign(params, st); err != nil {
+		t.Fatalf("error: split values failed: %v\n", err)
+	}
+	if len(st.IDs) != 3 || st.IDs[2] != 3 {
+		t.Fatalf("error: ids not split: %v\n", st.IDs)
+	}
+	if strings.Join(st.Tags, ",") != "a,b,c" || st.Name != "john" || len(st.Spaced) != 2 {
+		t.Fatalf("error: values not split or trimmed: %v\n", st)
+	}
+	if params.Get("ids") != "1,2,3," {
+		t.Fatalf("error: input params were modified\n")
+	}
+
+	// repeated keys and split values are combined.
+	params, _ = url.ParseQuery("ids=1,2&ids=3")
+	st = &SplitForm{}
+	if err := Assign(params, st); err != nil || len(st.IDs) != 3 {
+		t.Fatalf("error: repeated split values not combined: %v %v\n", st.IDs, err)
+	}
+
+	single := map[string]string{"ids": "5, 6"}
+	if err := AssignSingle(single, &SplitForm{}); err == nil {
+		t.Fatalf("error: untrimmed ' 6' parsed as an int\n")
+	}
+	single = map[string]string{"ids": "5,6,7,8,9"}
+	if verr, ok := AssignSingle(single, &SplitForm{}).(*ValidationError); !ok || verr.Rule != "count(1:4)" {
+		t.Fatalf("error: count not checked against split values\n")
+	}
+	single = map[string]string{"ids": "5,600"}
+	if verr, ok := AssignSingle(single, &SplitForm{}).(*ValidationError); !ok || verr.Value != "600" {
+		t.Fatalf("error: range not checked for each split value\n")
+	}
+
+	if _, ok := Assign(params, &BadSplitForm{}).(*FuncTypeError); !ok {
+		t.Fatalf("error: split on an int field should be a FuncTypeError\n")
+	}
+}
+
+type LineItem struct {
+	Name string   `validate:"name,len(1:20)"`
+	Qty  int      `validate:"qty,range(1:10)"`
+	Tags []string `validate:"tags,optional"`
+}
+
+type OrderForm struct {
+	Items  []LineItem  `validate:"items,count(1:3)"`
+	Extras []*LineItem `validate:"extras,optional"`
+	Tags   []string    `validate:"tags,optional"`
+}
+
+type RecursiveForm struct {
+	Children []RecursiveForm `validate:"children,optional"`
+}
+
+func TestNormalizeParam(t *testing.T) {
+	tests := map[string]string{
+		"name":                  "name",
+		"tags[]":                "tags",
+		"items[0][name]":        "items[0].name",
+		"items[01][tags][]":     "items[01].tags",
+		"items[2].qty":          "items[2].qty",
+		"items[0][parts][3][x]": "items[0].parts[3].x",
+		"meta[color]":           "meta.color",
+		"[0]":                   "[0]",
+		"broken[0":              "broken[0",
+	}
+	for param, expected := range tests {
+		if normalized := normalizeParam(param); normalized != expected {
+			t.Fatalf("error: %s normalized to %s expected %s\n", param, normalized, expected)
+		}
+	}
+}
+
+func TestIndexedParams(t *testing.T) {
+	params, _ := url.ParseQuery("items[0][name]=a&items[0][qty]=2&items[1][name]=b&items[1][qty]=3&items[1][tags][]=x&items[1][tags][]=y&tags[]=p&tags[]=q&extras[0][name]=e&extras[0][qty]=1")
+	st := &OrderForm{}
+	if err := Assign(params, st); err != nil {
+		t.Fatalf("error: assigning indexed params failed: %v\n", err)
+	}
+	if len(st.Items) != 2 || st.Items[0].Name != "a" || st.Items[1].Qty != 3 || len(st.Items[1].Tags) != 2 {
+		t.Fatalf("error: items not assigned: %v\n", st.Items)
+	}
+	if len(st.Tags) != 2 || st.Tags[1] != "q" || len(st.Extras) != 1 || st.Extras[0].Name != "e" {
+		t.Fatalf("error: tags or extras not assigned: %v %v\n", st.Tags, st.Extras)
+	}
+
+	// parameters which normalize to the same name are merged in the same order every time.
+	for i := 0; i < 20; i++ {
+		params, _ = url.ParseQuery("items[0][name]=a&items[0].qty=2&items[0][qty]=3&tags=p&tags[]=q")
+		st = &OrderForm{}
+		if err := Assign(params, st); err != nil || st.Items[0].Qty != 2 || strings.Join(st.Tags, ",") != "p,q" {
+			t.Fatalf("error: merged params not in a fixed order: %v %v %v\n", st.Items, st.Tags, err)
+		}
+	}
+
+	// errors report the path of the element.
+	params, _ = url.ParseQuery("items[0][qty]=2&items[1][name]=b&items[1][qty]=50")
+	err := AssignAll(params, &OrderForm{})
+	verrs, ok := err.(ValidationErrors)
+	if !ok || len(verrs) != 2 {
+		t.Fatalf("error: expected 2 ValidationErrors got %v\n", err)
+	}
+	if verrs[0].Param != "items[0].name" || verrs[0].Field != "Items[0].Name" || verrs[0].Rule != "required" {
+		t.Fatalf("error: wrong path for missing name: %#v\n", verrs[0])
+	}
+	if verrs[1].Param != "items[1].qty" || verrs[1].Rule != "range(1:10)" {
+		t.Fatalf("error: wrong path for qty: %#v\n", verrs[1])
+	}
+
+	// a skipped index is an element with missing fields.
+	params, _ = url.ParseQuery("items[1][name]=b&items[1][qty]=1")
+	if rerr, ok := Assign(params, &OrderForm{}).(*RequiredParamError); !ok || rerr.Param != "items[0].name" {
+		t.Fatalf("error: skipped index not reported\n")
+	}
+	params, _ = url.ParseQuery("items[3][name]=b&items[3][qty]=1")
+	if verr, ok := Assign(params, &OrderForm{}).(*ValidationError); !ok || verr.Rule != "count(1:3)" {
+		t.Fatalf("error: count not checked for indexed params\n")
+	}
+	if _, ok := Assign(map[string][]string{}, &OrderForm{}).(*RequiredParamError); !ok {
+		t.Fatalf("error: missing items should be required\n")
+	}
+
+	vd := New(MaxIndex(5))
+	params, _ = url.ParseQuery("items[6][name]=b")
+	if ierr, ok := vd.Assign(params, &OrderForm{}).(*IndexError); !ok || ierr.Index != 6 || ierr.Max != 5 {
+		t.Fatalf("error: index larger than MaxIndex accepted\n")
+	}
+	verrs, _ = vd.AssignAll(params, &OrderForm{}).(ValidationErrors)
+	if len(verrs) != 1 || verrs[0].Rule != "index" || verrs[0].Param != "items[6].name" {
+		t.Fatalf("error: IndexError not collected: %v\n", verrs)
+	}
+
+	vd = New(Strict())
+	params, _ = url.ParseQuery("items[0][name]=a&items[0][qty]=2&items[0][bogus]=1&items[x][name]=a&items[00][name]=a")
+	uerr, ok := vd.Assign(params, &OrderForm{}).(*UnknownParamError)
+	if !ok || strings.Join(uerr.Params, ",") != "items[00][name],items[0][bogus],items[x][name]" {
+		t.Fatalf("error: unknown indexed params not reported: %v\n", uerr)
+	}
+
+	if err := Precompile(&RecursiveForm{}); err == nil {
+		t.Fatalf("error: recursive slice of structures should not compile\n")
+	}
+}
+
+func TestValidateIndexed(t *testing.T) {
+	st := &OrderForm{Items: []LineItem{{Name: "a", Qty: 1}, {Name: "b"}}, Extras: []*LineItem{nil}}
+	if rerr, ok := Validate(st).(*RequiredParamError); !ok || rerr.Param != "items[1].qty" {
+		t.Fatalf("error: expected items[1].qty to be required got %v\n", rerr)
+	}
+	st.Items[1].Qty = 2
+	if err := Validate(st); err != nil {
+		t.Fatalf("error: valid items failed: %v\n", err)
+	}
+}
+
+type MetaForm struct {
+	Meta   map[string]string  `validate:"meta,count(1:3),len(1:10)" keys:"oneof(color|size|fit)"`
+	Scores map[string][]int   `validate:"scores,optional,range(0:100)" keymatch:"^[a-z]+$"`
+	Labels map[string]*string `validate:"labels,optional"`
+}
+
+type BadMapForm struct {
+	Meta map[int]string `validate:"meta"`
+}
+
+type BadKeysForm struct {
+	Name string `validate:"name" keys:"len(1:2)"`
+}
+
+func TestMapParams(t *testing.T) {
+	params, _ := url.ParseQuery("meta[color]=red&meta[size]=L&scores[math]=90&scores[math]=80&scores[art]=70&labels[007]=bond&labels[x]=")
+	st := &MetaForm{}
+	if err := Assign(params, st); err != nil {
+		t.Fatalf("error: assigning map params failed: %v\n", err)
+	}
+	if len(st.Meta) != 2 || st.Meta["color"] != "red" || st.Meta["size"] != "L" {
+		t.Fatalf("error: meta not assigned: %v\n", st.Meta)
+	}
+	if len(st.Scores["math"]) != 2 || st.Scores["art"][0] != 70 {
+		t.Fatalf("error: scores not assigned: %v\n", st.Scores)
+	}
+	if len(st.Labels) != 1 || *st.Labels["007"] != "bond" {
+		t.Fatalf("error: labels not assigned, empty optional entries should be skipped: %v\n", st.Labels)
+	}
+
+	// dotted keys are the same as brackets.
+	st = &MetaForm{}
+	if err := AssignSingle(map[string]string{"meta.fit": "slim"}, st); err != nil || st.Meta["fit"] != "slim" {
+		t.Fatalf("error: dotted map key not assigned: %v %v\n", st.Meta, err)
+	}
+
+	params, _ = url.ParseQuery("meta[shape]=round")
+	if verr, ok := Assign(params, &MetaForm{}).(*ValidationError); !ok || verr.Param != "meta[shape]" || verr.Value != "shape" {
+		t.Fatalf("error: key not validated by keys tag: %v\n", verr)
+	}
+	params, _ = url.ParseQuery("meta[color]=red&scores[Math]=1")
+	if verr, ok := Assign(params, &MetaForm{}).(*ValidationError); !ok || verr.Rule != "regex" {
+		t.Fatalf("error: key not validated by keymatch tag\n")
+	}
+	params, _ = url.ParseQuery("meta[color]=red&meta[size]=L&meta[fit]=slim&meta[x]=1")
+	if verr, ok := Assign(params, &MetaForm{}).(*ValidationError); !ok || verr.Rule != "count(1:3)" {
+		t.Fatalf("error: number of entries not limited\n")
+	}
+	params, _ = url.ParseQuery("meta[color]=")
+	if rerr, ok := Assign(params, &MetaForm{}).(*RequiredParamError); !ok || rerr.Param != "meta[color]" {
+		t.Fatalf("error: empty entry should be required\n")
+	}
+	if _, ok := Assign(map[string][]string{}, &MetaForm{}).(*RequiredParamError); !ok {
+		t.Fatalf("error: missing map should be required\n")
+	}
+
+	params, _ = url.ParseQuery("meta[color]=red&scores[math]=101")
+	verrs, ok := AssignAll(params, &MetaForm{}).(ValidationErrors)
+	if !ok || len(verrs) != 1 || verrs[0].Param != "scores[math]" || verrs[0].Field != "Scores" || verrs[0].Value != "101" {
+		t.Fatalf("error: map entry error has wrong param: %v\n", verrs)
+	}
+
+	// every bad entry is collected, the valid ones are still assigned.
+	params, _ = url.ParseQuery("limits[a]=0&limits[b]=2&limits[c]=1")
+	limits := &LimitsForm{}
+	verrs, ok = AssignAll(params, limits).(ValidationErrors)
+	if !ok || len(verrs) != 2 || verrs[0].Param != "limits[a]" || verrs[0].Rule != "gt(0)" || verrs[1].Param != "limits[c]" || verrs[1].Value != "c" {
+		t.Fatalf("error: map entry errors not collected: %v\n", verrs)
+	}
+	if len(limits.Limits) != 1 || limits.Limits["b"] != 2 {
+		t.Fatalf("error: valid map entries not assigned: %v\n", limits.Limits)
+	}
+
+	vd := New(Strict())
+	params, _ = url.ParseQuery("meta[color]=red&metadata=1")
+	if uerr, ok := vd.Assign(params, &MetaForm{}).(*UnknownParamError); !ok || strings.Join(uerr.Params, ",") != "metadata" {
+		t.Fatalf("error: strict mode should know map keys: %v\n", uerr)
+	}
+
+	if err := Precompile(&BadMapForm{}, &BadKeysForm{}); err == nil || len(err.(CompileErrors)) != 2 {
+		t.Fatalf("error: expected 2 compile errors got %v\n", err)
+	}
+}
+
+func TestValidateMap(t *testing.T) {
+	st := &MetaForm{Meta: map[string]string{"color": "red", "size": ""}}
+	if rerr, ok := Validate(st).(*RequiredParamError); !ok || rerr.Param != "meta[size]" {
+		t.Fatalf("error: expected meta[size] to be required got %v\n", rerr)
+	}
+	st.Meta["size"] = "L"
+	st.Scores = map[string][]int{"math": {200}}
+	if verr, ok := Validate(st).(*ValidationError); !ok || verr.Param != "scores[math]" {
+		t.Fatalf("error: expected scores[math] to fail range got %v\n", verr)
+	}
+	st.Scores["math"][0] = 20
+	if err := Validate(st); err != nil {
+		t.Fatalf("error: valid map failed: %v\n", err)
+	}
+}
+
+type ArrayForm struct {
+	RGB     [3]uint8          `validate:"rgb"`
+	Options [4]string         `validate:"options,optional,partial,minitems(2),unique,len(1:5)"`
+	Point   [2]float64        `validate:"point,optional,split(,)"`
+	Grid    map[string][2]int `validate:"grid,optional"`
+	Sizes   [3]int            `validate:"sizes,optional,minitems(1)"`
+}
+
+type BadPartialForm struct {
+	Tags []string `validate:"tags,partial"`
+}
+
+type StructArrayForm struct {
+	Items [2]ContactLine `validate:"items"`
+}
+
+func TestArrays(t *testing.T) {
+	params, _ := url.ParseQuery("rgb=255&rgb=128&rgb=0&options=a&options=b&point=1.5,2&grid[x]=1&grid[x]=2")
+	st := &ArrayForm{}
+	if err := Assign(params, st); err != nil {
+		t.Fatalf("error: assigning arrays failed: %v\n", err)
+	}
+	if st.RGB != [3]uint8{255, 128, 0} || st.Options != [4]string{"a", "b", "", ""} {
+		t.Fatalf("error: arrays not assigned: %v %v\n", st.RGB, st.Options)
+	}
+	if st.Point != [2]float64{1.5, 2} || st.Grid["x"] != [2]int{1, 2} {
+		t.Fatalf("error: split array or map of arrays not assigned: %v %v\n", st.Point, st.Grid)
+	}
+
+	params, _ = url.ParseQuery("rgb=255&rgb=128")
+	if verr, ok := Assign(params, &ArrayForm{}).(*ValidationError); !ok || verr.Rule != "array" || verr.Value != "2" {
+		t.Fatalf("error: too few values for an array accepted\n")
+	}
+	params, _ = url.ParseQuery("rgb=1&rgb=2&rgb=3&options=a&options=b&options=c&options=d&options=e")
+	if verr, ok := Assign(params, &ArrayForm{}).(*ValidationError); !ok || verr.Rule != "array" {
+		t.Fatalf("error: too many values for an array accepted\n")
+	}
+	params, _ = url.ParseQuery("rgb=1&rgb=2&rgb=3&options=a")
+	if verr, ok := Assign(params, &ArrayForm{}).(*ValidationError); !ok || verr.Rule != "minitems(2)" {
+		t.Fatalf("error: minitems not checked for a partial array\n")
+	}
+	// a count directive alone doesn't allow fewer values.
+	params, _ = url.ParseQuery("rgb=1&rgb=2&rgb=3&sizes=1")
+	if verr, ok := Assign(params, &ArrayForm{}).(*ValidationError); !ok || verr.Rule != "array" {
+		t.Fatalf("error: too few values for an array with minitems accepted\n")
+	}
+	if _, ok := Assign(params, &BadPartialForm{}).(*FuncTypeError); !ok {
+		t.Fatalf("error: partial on a slice should be a FuncTypeError\n")
+	}
+	err := Precompile(&StructArrayForm{})
+	var ferr *FuncTypeError
+	if !errors.As(err, &ferr) || ferr.Param != "items" {
+		t.Fatalf("error: array of structures should be a FuncTypeError got: %v\n", err)
+	}
+	params, _ = url.ParseQuery("rgb=1&rgb=2&rgb=3&options=a&options=a")
+	if verr, ok := Assign(params, &ArrayForm{}).(*ValidationError); !ok || verr.Rule != "unique" {
+		t.Fatalf("error: unique not checked for arrays\n")
+	}
+	params, _ = url.ParseQuery("rgb=1&rgb=2&rgb=3&grid[x]=1")
+	if _, ok := Assign(params, &ArrayForm{}).(*ValidationError); !ok {
+		t.Fatalf("error: too few values for a map of arrays accepted\n")
+	}
+	params, _ = url.ParseQuery("rgb=1&rgb=2&rgb=300")
+	if _, ok := Assign(params, &ArrayForm{}).(*TypeError); !ok {
+		t.Fatalf("error: overflowing array element accepted\n")
+	}
+
+	if err := Validate(&ArrayForm{RGB: [3]uint8{1, 2, 3}, Options: [4]string{"toolong"}}); err == nil {
+		t.Fatalf("error: array elements not validated\n")
+	}
+}
+
+type DefaultForm struct {
+	Limit  int           `validate:"limit,range(1:100),default(10)"`
+	Status string        `validate:"status,oneof(draft|published),default(draft)"`
+	Tags   []string      `validate:"tags,split(,),trim,default(a, b)"`
+	Since  time.Time     `validate:"since,layout(date),default(2020-01-01)"`
+	Page   *int          `validate:"page,default(1)"`
+	Wait   time.Duration `validate:"wait,default(1m30s)"`
+}
+
+type BadDefaultForm struct {
+	Limit int      `validate:"limit,range(1:100),default(200)"`
+	Name  string   `validate:"name,default(x)" regex:"^[a-z]{2,}$"`
+	Count int      `validate:"count,default(ten)"`
+	Tags  []string `validate:"tags,count(2:),default(a)"`
+	Empty string   `validate:"empty,default()"`
+	Where Address  `validate:"where,default(x)"`
+}
+
+func TestDefault(t *testing.T) {
+	params, _ := url.ParseQuery("status=&tags=")
+	st := &DefaultForm{}
+	if err := Assign(params, st); err != nil {
+		t.Fatalf("error: assigning defaults failed: %v\n", err)
+	}
+	if st.Limit != 10 || st.Status != "draft" || strings.Join(st.Tags, "|") != "a|b" {
+		t.Fatalf("error: defaults not assigned: %v\n", st)
+	}
+	if st.Since.Year() != 2020 || st.Page == nil || *st.Page != 1 || st.Wait != 90*time.Second {
+		t.Fatalf("error: defaults not assigned: %v\n", st)
+	}
+
+	params, _ = url.ParseQuery("limit=50&status=published&tags=x")
+	st = &DefaultForm{}
+	if err := Assign(params, st); err != nil || st.Limit != 50 || st.Status != "published" || len(st.Tags) != 1 {
+		t.Fatalf("error: submitted values should replace defaults: %v %v\n", st, err)
+	}
+
+	// submitted values are still validated.
+	params, _ = url.ParseQuery("limit=500")
+	if _, ok := Assign(params, &DefaultForm{}).(*ValidationError); !ok {
+		t.Fatalf("error: submitted value not validated\n")
+	}
+
+	err := Precompile(&BadDefaultForm{})
+	errs, ok := err.(CompileErrors)
+	if !ok || len(errs) != 6 {
+		t.Fatalf("error: expected 6 bad defaults got %v\n", err)
+	}
+	for _, cerr := range errs[:5] {
+		if _, ok := cerr.Err.(*FuncError); !ok {
+			t.Fatalf("error: expected FuncError for bad default got %v\n", cerr.Err)
+		}
+	}
+	if _, ok := errs[5].Err.(*FuncTypeError); !ok {
+		t.Fatalf("error: default on a structure should be a FuncTypeError got %v\n", errs[5].Err)
+	}
+
+	// defaults make a field optional for Validate.
+	if err := Validate(&DefaultForm{}); err != nil {
+		t.Fatalf("error: zero values of fields with defaults failed: %v\n", err)
+	}
+}
+
+type PasswordForm struct {
+	Password string      `validate:"password,len(8:64)"`
+	Confirm  string      `validate:"confirm,eqfield(Password)"`
+	Old      string      `validate:"old,optional,nefield(Password)"`
+	Start    time.Time   `validate:"start,layout(date)"`
+	End      *time.Time  `validate:"end,optional,layout(date),gtfield(Start)"`
+	Min      int         `validate:"min,optional"`
+	Max      int         `validate:"max,optional,gtefield(Min)"`
+	Lines    []PriceLine `validate:"lines,optional"`
+}
+
+type PriceLine struct {
+	Low  float64 `validate:"low"`
+	High float64 `validate:"high,gtfield(Low)"`
+}
+
+type BadCompareForm struct {
+	A        string `validate:"a,eqfield(Missing)"`
+	B        int    `validate:"b,eqfield(A)"`
+	C        bool   `validate:"c,gtfield(D)"`
+	D        bool   `validate:"d"`
+	E        []int  `validate:"e,eqfield(B)"`
+	F        string `validate:"f,eqfield(Untagged)"`
+	G        string `validate:"g,eqfield()"`
+	Untagged string
+}
+
+func TestFieldCompare(t *testing.T) {
+	params, _ := url.ParseQuery("password=secret123&confirm=secret123&start=2024-01-01&end=2024-02-01&min=5&max=5&lines[0][low]=1&lines[0][high]=2")
+	st := &PasswordForm{}
+	if err := Assign(params, st); err != nil {
+		t.Fatalf("error: valid comparisons failed: %v\n", err)
+	}
+
+	params.Set("confirm", "secret124")
+	if verr, ok := Assign(params, &PasswordForm{}).(*ValidationError); !ok || verr.Rule != "eqfield(Password)" || verr.Param != "confirm" {
+		t.Fatalf("error: eqfield not checked: %v\n", verr)
+	}
+	params.Set("confirm", "secret123")
+	params.Set("old", "secret123")
+	if verr, ok := Assign(params, &PasswordForm{}).(*ValidationError); !ok || verr.Rule != "nefield(Password)" {
+		t.Fatalf("error: nefield not checked\n")
+	}
+	params.Del("old")
+	params.Set("end", "2023-12-31")
+	if verr, ok := Assign(params, &PasswordForm{}).(*ValidationError); !ok || verr.Rule != "gtfield(Start)" {
+		t.Fatalf("error: gtfield not checked for times\n")
+	}
+	params.Set("end", "2024-02-01")
+	params.Set("lines[0][high]", "0.5")
+	if verr, ok := Assign(params, &PasswordForm{}).(*ValidationError); !ok || verr.Param != "lines[0].high" {
+		t.Fatalf("error: gtfield not checked for elements: %v\n", verr)
+	}
+	params.Set("lines[0][high]", "2")
+
+	// optional fields which are missing are not compared.
+	params.Del("min")
+	params.Del("end")
+	if err := Assign(params, &PasswordForm{}); err != nil {
+		t.Fatalf("error: missing optional fields compared: %v\n", err)
+	}
+
+	// fields which fail are not compared again.
+	params.Set("password", "short")
+	params.Set("confirm", "other")
+	params.Set("max", "x")
+	verrs, ok := AssignAll(params, &PasswordForm{}).(ValidationErrors)
+	if !ok || len(verrs) != 2 || verrs[0].Param != "password" || verrs[1].Param != "max" {
+		t.Fatalf("error: expected password and max errors got %v\n", verrs)
+	}
+
+	err := Precompile(&BadCompareForm{})
+	errs, ok := err.(CompileErrors)
+	if !ok || len(errs) != 6 {
+		t.Fatalf("error: expected 6 bad comparisons got %v\n", err)
+	}
+
+	v := &PasswordForm{Password: "secret123", Confirm: "secret12", Start: time.Now()}
+	if verr, ok := Validate(v).(*ValidationError); !ok || verr.Rule != "eqfield(Password)" {
+		t.Fatalf("error: Validate did not compare fields: %v\n", Validate(v))
+	}
+}
+
+type CheckoutForm struct {
+	Method   string `validate:"payment_method,oneof(card|bank|cash)"`
+	Card     string `validate:"card_number,required_if(payment_method=card),excluded_if(payment_method=cash)"`
+	Account  string `validate:"account,required_if(payment_method=bank)"`
+	Street   string `validate:"street,optional"`
+	City     string `validate:"city,required_with(street)"`
+	Email    string `validate:"email,required_without(phone)"`
+	Phone    string `validate:"phone,required_without(email)"`
+	Quantity int    `validate:"quantity,optional,range(1:5),required_if(payment_method=card|bank)"`
+}
+
+type BadConditionForm struct {
+	A string            `validate:"a,required_if(missing=1)"`
+	B string            `validate:"b,required_if(a)"`
+	C string            `validate:"c,required_with()"`
+	D map[string]string `validate:"d,required_with(a)"`
+}
+
+func TestConditions(t *testing.T) {
+	params, _ := url.ParseQuery("payment_method=card&card_number=4111&email=a@b.c&quantity=2")
+	if err := Assign(params, &CheckoutForm{}); err != nil {
+		t.Fatalf("error: valid checkout failed: %v\n", err)
+	}
+
+	params.Del("card_number")
+	rerr, ok := Assign(params, &CheckoutForm{}).(*RequiredParamError)
+	if !ok || rerr.Param != "card_number" || rerr.Condition != "required_if(payment_method=card)" {
+		t.Fatalf("error: required_if not checked: %v\n", rerr)
+	}
+	if !strings.Contains(rerr.Error(), "required_if(payment_method=card)") {
+		t.Fatalf("error: condition missing from message: %s\n", rerr)
+	}
+
+	params.Set("payment_method", "cash")
+	params.Set("card_number", "4111")
+	eerr, ok := Assign(params, &CheckoutForm{}).(*ExcludedParamError)
+	if !ok || eerr.Param != "card_number" || eerr.Condition != "excluded_if(payment_method=cash)" {
+		t.Fatalf("error: excluded_if not checked: %v\n", eerr)
+	}
+	params.Del("card_number")
+	params.Del("quantity")
+	if err := Assign(params, &CheckoutForm{}); err != nil {
+		t.Fatalf("error: cash checkout without card failed: %v\n", err)
+	}
+
+	params.Set("payment_method", "bank")
+	params.Set("account", "123")
+	if rerr, ok := Assign(params, &CheckoutForm{}).(*RequiredParamError); !ok || rerr.Param != "quantity" {
+		t.Fatalf("error: required_if with several values not checked\n")
+	}
+	params.Set("quantity", "2")
+
+	params.Set("street", "1 Main St")
+	if rerr, ok := Assign(params, &CheckoutForm{}).(*RequiredParamError); !ok || rerr.Condition != "required_with(street)" {
+		t.Fatalf("error: required_with not checked\n")
+	}
+	params.Set("city", "Springfield")
+
+	params.Del("email")
+	if rerr, ok := Assign(params, &CheckoutForm{}).(*RequiredParamError); !ok || rerr.Param != "email" || rerr.Condition != "required_without(phone)" {
+		t.Fatalf("error: required_without not checked\n")
+	}
+	params.Set("phone", "555")
+	if err := Assign(params, &CheckoutForm{}); err != nil {
+		t.Fatalf("error: phone should satisfy required_without: %v\n", err)
+	}
+
+	params, _ = url.ParseQuery("payment_method=cash&card_number=1")
+	verrs, _ := AssignAll(params, &CheckoutForm{}).(ValidationErrors)
+	if len(verrs) != 3 || verrs[0].Rule != "excluded_if(payment_method=cash)" || verrs[1].Rule != "required_without(phone)" {
+		t.Fatalf("error: conditions not collected: %v\n", verrs)
+	}
+
+	err := Precompile(&BadConditionForm{})
+	if errs, ok := err.(CompileErrors); !ok || len(errs) != 4 {
+		t.Fatalf("error: expected 4 bad conditions got %v\n", err)
+	}
+
+	st := &CheckoutForm{Method: "card", Email: "a@b.c", Quantity: 1}
+	if rerr, ok := Validate(st).(*RequiredParamError); !ok || rerr.Condition != "required_if(payment_method=card)" {
+		t.Fatalf("error: Validate did not check conditions: %v\n", Validate(st))
+	}
+	st.Card = "4111"
+	if err := Validate(st); err != nil {
+		t.Fatalf("error: valid checkout failed Validate: %v\n", err)
+	}
+}
+
+type ContactForm struct {
+	_        struct{}      `group:"exactlyone(email|phone|username)"`
+	_        struct{}      `group:"atmostone(fax|pager),atleastone(name|nick)"`
+	Email    string        `validate:"email,optional"`
+	Phone    string        `validate:"phone,optional"`
+	Username string        `validate:"username,optional"`
+	Fax      string        `validate:"fax,optional"`
+	Pager    string        `validate:"pager,optional"`
+	Name     string        `validate:"name,optional"`
+	Nick     string        `validate:"nick,optional"`
+	Contacts []ContactLine `validate:"contacts,optional"`
+}
+
+type ContactLine struct {
+	_     struct{} `group:"exactlyone(email|phone)"`
+	Email string   `validate:"email,optional"`
+	Phone string   `validate:"phone,optional"`
+}
+
+type BadGroupForm struct {
+	_ struct{} `group:"exactlyone(a|missing)"`
+	_ struct{} `group:"exactlyone(a)"`
+	_ struct{} `group:"oneof(a|b)"`
+	A string   `validate:"a,optional" group:"atmostone(a|a)"`
+}
+
+type MapGroupForm struct {
+	_    struct{}          `group:"atleastone(meta|name)"`
+	Name string            `validate:"name,optional"`
+	Meta map[string]string `validate:"meta,optional"`
+}
+
+type ElemGroupForm struct {
+	_     struct{}      `group:"exactlyone(items|name)"`
+	Name  string        `validate:"name,optional"`
+	Items []ContactLine `validate:"items,optional"`
+}
+
+func TestGroups(t *testing.T) {
+	params, _ := url.ParseQuery("email=a@b.c&name=x&contacts[0][phone]=555")
+	if err := Assign(params, &ContactForm{}); err != nil {
+		t.Fatalf("error: valid groups failed: %v\n", err)
+	}
+
+	params.Set("phone", "555")
+	gerr, ok := Assign(params, &ContactForm{}).(*GroupError)
+	if !ok || gerr.Count != 2 || gerr.Rule != "exactlyone(email|phone|username)" || strings.Join(gerr.Members, ",") != "email,phone,username" {
+		t.Fatalf("error: exactlyone not checked: %v\n", gerr)
+	}
+	params.Del("phone")
+	params.Del("email")
+	if gerr, ok := Assign(params, &ContactForm{}).(*GroupError); !ok || gerr.Count != 0 {
+		t.Fatalf("error: exactlyone with no members not checked\n")
+	}
+	params.Set("username", "ab")
+
+	params.Set("fax", "1")
+	params.Set("pager", "2")
+	if gerr, ok := Assign(params, &ContactForm{}).(*GroupError); !ok || gerr.Rule != "atmostone(fax|pager)" {
+		t.Fatalf("error: atmostone not checked\n")
+	}
+	params.Del("pager")
+	params.Del("name")
+	if gerr, ok := Assign(params, &ContactForm{}).(*GroupError); !ok || gerr.Rule != "atleastone(name|nick)" {
+		t.Fatalf("error: atleastone not checked\n")
+	}
+	params.Set("nick", "n")
+
+	params.Set("contacts[0][email]", "c@d.e")
+	verrs, ok := AssignAll(params, &ContactForm{}).(ValidationErrors)
+	if !ok || len(verrs) != 1 || verrs[0].Param != "contacts[0].email,contacts[0].phone" || verrs[0].Value != "2" {
+		t.Fatalf("error: element group not collected: %v\n", verrs)
+	}
+
+	err := Precompile(&BadGroupForm{})
+	if errs, ok := err.(CompileErrors); !ok || len(errs) != 4 {
+		t.Fatalf("error: expected 4 bad groups got %v\n", err)
+	}
+	// maps and slices of structures have no parameter of their own to count.
+	if _, ok := Assign(url.Values{"meta[color]": {"red"}}, &MapGroupForm{}).(*FuncTypeError); !ok {
+		t.Fatalf("error: map group member should be a FuncTypeError\n")
+	}
+	if _, ok := Assign(url.Values{"items[0][email]": {"x"}}, &ElemGroupForm{}).(*FuncTypeError); !ok {
+		t.Fatalf("error: slice of structures group member should be a FuncTypeError\n")
+	}
+
+	if _, ok := Validate(&ContactForm{Email: "a", Phone: "b", Name: "n"}).(*GroupError); !ok {
+		t.Fatalf("error: Validate did not check groups\n")
+	}
+	if err := Validate(&ContactForm{Email: "a", Name: "n"}); err != nil {
+		t.Fatalf("error: valid groups failed Validate: %v\n", err)
+	}
+}
+
+type UniqueIPForm struct {
+	Addrs []net.IP `validate:"addrs,unique"`
+}
+
+func TestUniqueUnhashable(t *testing.T) {
+	params, _ := url.ParseQuery("addrs=1.2.3.4&addrs=1.2.3.5")
+	st := &UniqueIPForm{}
+	if err := Assign(params, st); err != nil || len(st.Addrs) != 2 {
+		t.Fatalf("error: unique net.IP values failed: %v\n", err)
+	}
+	params.Add("addrs", "1.2.3.4")
+	if verr, ok := Assign(params, &UniqueIPForm{}).(*ValidationError); !ok || verr.Rule != "unique" || verr.Value != "1.2.3.4" {
+		t.Fatalf("error: repeated net.IP accepted: %v\n", verr)
+	}
+}
+
+type IPForm struct {
+	Addr  net.IP            `validate:"addr"`
+	Ptr   *net.IP           `validate:"ptr,optional"`
+	Hosts map[string]net.IP `validate:"hosts,optional"`
+}
+
+type BadIPForm struct {
+	Addr net.IP `validate:"addr,count(1:4)"`
+}
+
+func TestSliceTypeConverter(t *testing.T) {
+	params, _ := url.ParseQuery("addr=1.2.3.4&ptr=::1&hosts[db]=10.0.0.1")
+	st := &IPForm{}
+	if err := Assign(params, st); err != nil {
+		t.Fatalf("error: net.IP fields failed: %v\n", err)
+	}
+	if !st.Addr.Equal(net.ParseIP("1.2.3.4")) || st.Ptr == nil || !st.Ptr.Equal(net.IPv6loopback) || !st.Hosts["db"].Equal(net.ParseIP("10.0.0.1")) {
+		t.Fatalf("error: net.IP fields not assigned: %v\n", st)
+	}
+
+	params.Set("addr", "1.2.3")
+	st = &IPForm{}
+	if _, ok := Assign(params, st).(*TypeError); !ok || st.Addr != nil {
+		t.Fatalf("error: bad net.IP should be a TypeError and leave the field unset: %v\n", st.Addr)
+	}
+
+	if err := Validate(&IPForm{Addr: net.ParseIP("1.2.3.4")}); err != nil {
+		t.Fatalf("error: net.IP field failed Validate: %v\n", err)
+	}
+	if _, ok := Assign(params, &BadIPForm{}).(*FuncTypeError); !ok {
+		t.Fatalf("error: count on a net.IP field should be a FuncTypeError\n")
+	}
+}
+
+type LimitsForm struct {
+	Limits map[string]int `validate:"limits,gt(0)" keys:"oneof(a|b)"`
+}
+
 //HELPERS
 func makeSimpleMap() map[string][]string {
 	val := make(map[string][]string, 2)